@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/flga/gb/gb"
+)
+
+const (
+	audioViewW     = 256
+	audioViewLaneH = 48
+	audioViewH     = audioViewLaneH * 4
+
+	// samples shown in every oscilloscope, half of what the console keeps so
+	// that there's room to look for a trigger point
+	audioViewScopeLen = 2048
+)
+
+var (
+	channelColors = [4]color.RGBA{
+		{0x4c, 0xaf, 0x50, 0xFF},
+		{0x21, 0x96, 0xf3, 0xFF},
+		{0xff, 0x98, 0x00, 0xFF},
+		{0xe9, 0x1e, 0x63, 0xFF},
+	}
+	textColor  = color.RGBA{0xee, 0xee, 0xee, 0xFF}
+	mutedColor = color.RGBA{0x55, 0x55, 0x55, 0xFF}
+)
+
+var channelNames = [4]string{"P1", "P2", "WAVE", "NOISE"}
+
+// audioView draws an oscilloscope of every channel along with its note,
+// volume and duty.
+type audioView struct {
+	buf []float64
+}
+
+func (v *audioView) Draw(w *window, console *gb.GameBoy) {
+	for ch := gb.Pulse1; ch <= gb.Noise; ch++ {
+		y := int(ch) * audioViewLaneH
+		st := console.ChannelStatus(ch)
+
+		c := channelColors[ch]
+		if !st.Audible {
+			c = mutedColor
+		}
+
+		w.SetDrawColor(c)
+		drawText(w, 2, y+2, channelLabel(ch, st))
+
+		var flag string
+		switch {
+		case console.ChannelSoloed(ch):
+			flag = "SOLO"
+		case console.ChannelMuted(ch):
+			flag = "MUTE"
+		}
+		drawText(w, audioViewW-2-textWidth(flag), y+2, flag)
+
+		v.buf = console.ChannelScope(ch, v.buf[:0])
+		v.drawScope(w, y+10, audioViewLaneH-12)
+
+		if ch > gb.Pulse1 {
+			w.SetDrawColor(dividerColor)
+			w.DrawLine(0, y, audioViewW, y)
+		}
+	}
+}
+
+// drawScope draws the samples in buf, starting at the first rising edge so
+// that periodic waveforms stay still from frame to frame.
+func (v *audioView) drawScope(w *window, y, h int) {
+	if len(v.buf) < audioViewScopeLen {
+		return
+	}
+
+	lo, hi := v.buf[0], v.buf[0]
+	for _, s := range v.buf {
+		lo = math.Min(lo, s)
+		hi = math.Max(hi, s)
+	}
+	mid := (lo + hi) / 2
+
+	start := len(v.buf) - audioViewScopeLen
+	for i := 1; i < len(v.buf)-audioViewScopeLen; i++ {
+		if v.buf[i-1] <= mid && v.buf[i] > mid {
+			start = i
+			break
+		}
+	}
+	samples := v.buf[start : start+audioViewScopeLen]
+
+	perPixel := audioViewScopeLen / audioViewW
+	prevY := -1
+	for x := 0; x < audioViewW; x++ {
+		var sum float64
+		for _, s := range samples[x*perPixel : (x+1)*perPixel] {
+			sum += s
+		}
+		sample := sum / float64(perPixel)
+
+		// samples are in [-1, 1], -1 at the bottom
+		py := y + int((1-sample)/2*float64(h-1))
+		if prevY < 0 {
+			prevY = py
+		}
+		w.DrawLine(x-1, prevY, x, py)
+		prevY = py
+	}
+}
+
+func channelLabel(ch gb.Channel, st gb.ChannelStatus) string {
+	if !st.Enabled {
+		return fmt.Sprintf("%-5s OFF", channelNames[ch])
+	}
+
+	vol := fmt.Sprintf("VOL %3d%%", int(math.Round(st.Volume*100)))
+
+	switch ch {
+	case gb.Pulse1, gb.Pulse2:
+		return fmt.Sprintf("%-5s %-4s %5.0fHZ %s DUTY %4.1f%%", channelNames[ch], noteName(st.Frequency), st.Frequency, vol, st.Duty*100)
+	case gb.Wave:
+		return fmt.Sprintf("%-5s %-4s %5.0fHZ %s", channelNames[ch], noteName(st.Frequency), st.Frequency, vol)
+	default:
+		return fmt.Sprintf("%-5s %7.0fHZ %s", channelNames[ch], st.Frequency, vol)
+	}
+}
+
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// noteName returns the closest note to freq, in scientific pitch notation.
+func noteName(freq float64) string {
+	if freq <= 0 {
+		return "-"
+	}
+
+	// semitones from C0, A4 being 440Hz
+	n := int(math.Round(12*math.Log2(freq/440))) + 57
+	if n < 0 || n >= 12*10 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%s%d", noteNames[n%12], n/12)
+}
+
+// font is a 3x5 pixel font, every row is 3 bits wide with the msb on the
+// left.
+var font = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 3, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 2, 2},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'L': {4, 4, 4, 4, 7}, 'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5},
+	'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'Y': {5, 5, 2, 2, 2},
+	'Z': {7, 1, 2, 4, 7},
+	'#': {5, 7, 5, 7, 5}, '%': {5, 1, 2, 4, 5}, '.': {0, 0, 0, 0, 2}, '-': {0, 0, 7, 0, 0},
+}
+
+func textWidth(s string) int {
+	return len(s) * 4
+}
+
+// drawText draws s with the current draw color, characters missing from the
+// font are left blank.
+func drawText(w *window, x, y int, s string) {
+	for i, r := range s {
+		glyph := font[r]
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) > 0 {
+					w.FillRect(x+i*4+col, y+row, 1, 1)
+				}
+			}
+		}
+	}
+}
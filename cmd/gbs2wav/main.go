@@ -0,0 +1,88 @@
+// Command gbs2wav renders a track of a GBS file to a WAV file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flga/gb/gb"
+)
+
+func main() {
+	out := flag.String("o", "", "output file, defaults to the gbs name and track with a .wav extension")
+	track := flag.Int("track", 0, "track to render, 1 based, defaults to the first song in the header")
+	seconds := flag.Float64("t", 120, "how many seconds to render")
+	rate := flag.Int("rate", gb.DefaultSampleRate, "sample rate")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gbs2wav [flags] music.gbs")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, *track, *seconds, *rate); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(gbsPath, out string, track int, seconds float64, rate int) error {
+	f, err := os.Open(gbsPath)
+	if err != nil {
+		return fmt.Errorf("could not load gbs: %w", err)
+	}
+	defer f.Close()
+
+	cart, err := gb.NewGBSCartridge(f)
+	if err != nil {
+		return fmt.Errorf("could not load gbs: %w", err)
+	}
+
+	console := &gb.GameBoy{}
+	if err := console.InsertCartridge(cart, nil, nil); err != nil {
+		return err
+	}
+
+	info, _ := console.GBSInfo()
+	if track < 0 || track > info.Songs {
+		return fmt.Errorf("invalid track %d, the gbs has %d songs", track, info.Songs)
+	}
+	if track == 0 {
+		track = info.FirstSong + 1
+	}
+	console.SetTrack(track - 1)
+
+	if out == "" {
+		out = fmt.Sprintf("%s-%02d.wav", strings.TrimSuffix(gbsPath, filepath.Ext(gbsPath)), track)
+	}
+
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := console.StartRecording(gb.Recording{Rate: rate, Mix: w}); err != nil {
+		return err
+	}
+
+	for i := 0; i < int(seconds*gb.FrameRate); i++ {
+		console.ClockFrame()
+		console.AudioSamples()
+	}
+
+	if err := console.StopRecording(); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	fmt.Println(out)
+
+	return nil
+}
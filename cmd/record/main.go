@@ -0,0 +1,149 @@
+// Command record runs a rom headlessly, recording its audio to WAV files.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flga/gb/gb"
+)
+
+func main() {
+	out := flag.String("o", "", "output file, defaults to the rom name with a .wav extension")
+	stems := flag.Bool("stems", false, "also record every channel to its own file")
+	seconds := flag.Float64("t", 60, "how many seconds to record")
+	rate := flag.Int("rate", gb.DefaultSampleRate, "sample rate")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: record [flags] rom.gb")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, *stems, *seconds, *rate); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(romPath, out string, stems bool, seconds float64, rate int) error {
+	rom, err := os.Open(romPath)
+	if err != nil {
+		return fmt.Errorf("could not load rom: %w", err)
+	}
+	defer rom.Close()
+
+	cart, err := gb.NewCartridge(rom)
+	if err != nil {
+		return fmt.Errorf("could not load rom: %w", err)
+	}
+
+	// saves are loaded if present, but never written
+	var savr io.Reader
+	var savw io.WriteCloser
+	if cart.Saveable() {
+		data, err := ioutil.ReadFile(strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav")
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not load sav: %w", err)
+		}
+		savr = bytes.NewReader(data)
+		savw = nopWriteCloser{}
+	}
+
+	console := &gb.GameBoy{}
+	if err := console.InsertCartridge(cart, savr, savw); err != nil {
+		return err
+	}
+	console.PowerOn()
+
+	if out == "" {
+		out = strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".wav"
+	}
+
+	rec, files, err := createRecording(out, stems)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	rec.Rate = rate
+
+	if err := console.StartRecording(rec); err != nil {
+		return err
+	}
+
+	for i := 0; i < int(seconds*gb.FrameRate); i++ {
+		console.ClockFrame()
+		console.AudioSamples()
+	}
+
+	if err := console.StopRecording(); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Println(f.Name())
+	}
+
+	return nil
+}
+
+// createRecording creates the output files, stems are named after out with
+// the channel as a suffix.
+func createRecording(out string, stems bool) (gb.Recording, []*os.File, error) {
+	var rec gb.Recording
+	var files []*os.File
+
+	create := func(dst *io.WriteSeeker, path string) error {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		*dst = f
+		return nil
+	}
+
+	if err := create(&rec.Mix, out); err != nil {
+		return rec, files, err
+	}
+
+	if !stems {
+		return rec, files, nil
+	}
+
+	base := strings.TrimSuffix(out, filepath.Ext(out))
+	for _, stem := range []struct {
+		dst    *io.WriteSeeker
+		suffix string
+	}{
+		{&rec.Pulse1, "p1"},
+		{&rec.Pulse2, "p2"},
+		{&rec.Wave, "wave"},
+		{&rec.Noise, "noise"},
+	} {
+		if err := create(stem.dst, base+"-"+stem.suffix+".wav"); err != nil {
+			return rec, files, err
+		}
+	}
+
+	return rec, files, nil
+}
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
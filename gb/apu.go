@@ -1,5 +1,12 @@
 package gb
 
+const (
+	apuPower = 1 << 7
+
+	// the frame sequencer is clocked by the falling edge of bit 4 of DIV
+	frameSequencerBit = 1 << 12
+)
+
 type apu struct {
 	ChannelControl uint8 // 0xFF24 - NR50 - Channel control / ON-OFF / Volume (R/W)
 	OutputTerminal uint8 // 0xFF25 - NR51 - Selection of Sound output terminal (R/W)
@@ -9,27 +16,165 @@ type apu struct {
 	p2    pulse
 	wave  wave
 	noise noise
+
+	frameSeqStep uint8
+	prevDivBit   bool
+
+	// muted and soloed only affect the mix, the channels keep running
+	muted  [4]bool
+	soloed [4]bool
+}
+
+func (a *apu) powered() bool {
+	return a.OnOff&apuPower > 0
 }
 
 func (a *apu) clock(gb *GameBoy) {
+	divBit := gb.timer.DIV&frameSequencerBit > 0
+	falling := a.prevDivBit && !divBit
+	a.prevDivBit = divBit
+
+	if !a.powered() {
+		return
+	}
+
+	if falling {
+		a.clockFrameSequencer()
+	}
+
 	a.p1.clock(gb)
 	a.p2.clock(gb)
 	a.wave.clock(gb)
 	a.noise.clock(gb)
 }
 
-func (a *apu) sample() float64 {
-	p1 := a.p1.sample()
-	p2 := a.p2.sample()
-	wave := a.wave.sample()
-	noise := a.noise.sample()
+// clockFrameSequencer runs at 512Hz and drives the length counters (256Hz),
+// the sweep unit (128Hz) and the volume envelopes (64Hz).
+//
+//	Step   Length Ctr  Vol Env     Sweep
+//	---------------------------------------
+//	0      Clock       -           -
+//	1      -           -           -
+//	2      Clock       -           Clock
+//	3      -           -           -
+//	4      Clock       -           -
+//	5      -           -           -
+//	6      Clock       -           Clock
+//	7      -           Clock       -
+func (a *apu) clockFrameSequencer() {
+	if a.frameSeqStep%2 == 0 {
+		a.p1.clockLength()
+		a.p2.clockLength()
+		a.wave.clockLength()
+		a.noise.clockLength()
+	}
 
-	_ = p1
-	_ = p2
-	_ = wave
-	_ = noise
-	// TODO: combine samples
-	return 0
+	if a.frameSeqStep == 2 || a.frameSeqStep == 6 {
+		a.p1.clockSweep()
+	}
+
+	if a.frameSeqStep == 7 {
+		a.p1.clockEnvelope()
+		a.p2.clockEnvelope()
+		a.noise.clockEnvelope()
+	}
+
+	a.frameSeqStep = (a.frameSeqStep + 1) % 8
+}
+
+// lengthClockNext reports whether the next frame sequencer step clocks the
+// length counters.
+func (a *apu) lengthClockNext() bool {
+	return a.frameSeqStep%2 == 0
+}
+
+func (a *apu) setPower(on bool) {
+	if on == a.powered() {
+		return
+	}
+
+	if on {
+		a.OnOff |= apuPower
+		a.frameSeqStep = 0
+		a.p1.dutyStep = 0
+		a.p2.dutyStep = 0
+		a.wave.sampleBuffer = 0
+		return
+	}
+
+	// powering off clears every register except wave ram, on the DMG the
+	// length counters are also left untouched
+	a.OnOff &^= apuPower
+	a.ChannelControl = 0
+	a.OutputTerminal = 0
+	a.p1 = pulse{isPulse1: true, length: a.p1.length}
+	a.p2 = pulse{length: a.p2.length}
+	a.wave = wave{
+		Pattern: a.wave.Pattern,
+		length:  a.wave.length,
+	}
+	a.noise = noise{length: a.noise.length}
+
+	// the length enable flags are part of NRx4, which is cleared as well
+	a.p1.length.enabled = false
+	a.p2.length.enabled = false
+	a.wave.length.enabled = false
+	a.noise.length.enabled = false
+}
+
+// channels returns the dac output of every channel, in the [-1, 1] range.
+func (a *apu) channels() [4]float64 {
+	if !a.powered() {
+		return [4]float64{}
+	}
+
+	return [4]float64{
+		a.p1.sample(),
+		a.p2.sample(),
+		a.wave.sample(),
+		a.noise.sample(),
+	}
+}
+
+// mix routes the channels according to NR51 and NR50, returning the left and
+// right terminals in the [-1, 1] range.
+func (a *apu) mix(channels [4]float64) (left, right float64) {
+	// Bit 7-4 - Output sound 4-1 to SO2 terminal (left)
+	// Bit 3-0 - Output sound 4-1 to SO1 terminal (right)
+	for i, s := range channels {
+		if !a.audible(i) {
+			continue
+		}
+		if a.OutputTerminal&(1<<(i+4)) > 0 {
+			left += s
+		}
+		if a.OutputTerminal&(1<<i) > 0 {
+			right += s
+		}
+	}
+
+	// Bit 6-4 - SO2 output level (volume)  (0-7)
+	// Bit 2-0 - SO1 output level (volume)  (0-7)
+	leftVol := float64(a.ChannelControl>>4&0x07+1) / 8
+	rightVol := float64(a.ChannelControl&0x07+1) / 8
+
+	return left / 4 * leftVol, right / 4 * rightVol
+}
+
+// audible reports whether channel i is heard, a muted channel never is and
+// when any channel is soloed only the soloed ones are.
+func (a *apu) audible(i int) bool {
+	if a.muted[i] {
+		return false
+	}
+
+	for _, solo := range a.soloed {
+		if solo {
+			return a.soloed[i]
+		}
+	}
+
+	return true
 }
 
 func (a *apu) read(addr uint16) uint8 {
@@ -40,7 +185,20 @@ func (a *apu) read(addr uint16) uint8 {
 	case 0xFF25:
 		return a.OutputTerminal
 	case 0xFF26:
-		return a.OnOff
+		var status uint8
+		if a.p1.enabled {
+			status |= 1 << 0
+		}
+		if a.p2.enabled {
+			status |= 1 << 1
+		}
+		if a.wave.enabled {
+			status |= 1 << 2
+		}
+		if a.noise.enabled {
+			status |= 1 << 3
+		}
+		return 0x70 | a.OnOff&apuPower | status
 	}
 
 	// pulse1
@@ -72,7 +230,119 @@ func (a *apu) read(addr uint16) uint8 {
 }
 
 func (a *apu) write(addr uint16, v uint8) {
-	// todo
+	// apu ctrl
+	if addr == 0xFF26 {
+		a.setPower(v&apuPower > 0)
+		return
+	}
+
+	// wave pattern, accessible regardless of power
+	if addr >= 0xFF30 && addr <= 0xFF3F {
+		a.wave.write(addr, v, a.lengthClockNext())
+		return
+	}
+
+	if !a.powered() {
+		// on the DMG the length counters can be written while powered off
+		switch addr {
+		case 0xFF11:
+			a.p1.length.load(v & 0x3F)
+		case 0xFF16:
+			a.p2.length.load(v & 0x3F)
+		case 0xFF1B:
+			a.wave.write(addr, v, a.lengthClockNext())
+		case 0xFF20:
+			a.noise.write(addr, v, a.lengthClockNext())
+		}
+		return
+	}
+
+	switch addr {
+	case 0xFF24:
+		a.ChannelControl = v
+		return
+	case 0xFF25:
+		a.OutputTerminal = v
+		return
+	}
+
+	// pulse1
+	if addr >= 0xFF10 && addr <= 0xFF14 {
+		a.p1.write(addr, v, a.lengthClockNext())
+		return
+	}
+
+	// pulse2
+	if addr >= 0xFF16 && addr <= 0xFF19 {
+		a.p2.write(addr, v, a.lengthClockNext())
+		return
+	}
+
+	// wave
+	if addr >= 0xFF1A && addr <= 0xFF1E {
+		a.wave.write(addr, v, a.lengthClockNext())
+		return
+	}
+
+	// noise
+	if addr >= 0xFF20 && addr <= 0xFF23 {
+		a.noise.write(addr, v, a.lengthClockNext())
+		return
+	}
+}
+
+type lengthCounter struct {
+	enabled bool
+	value   uint16
+	max     uint16
+}
+
+func (l *lengthCounter) load(v uint8) {
+	l.value = l.max - uint16(v)
+}
+
+// clock returns true when the counter reached 0 and the channel must be
+// disabled.
+func (l *lengthCounter) clock() bool {
+	if !l.enabled || l.value == 0 {
+		return false
+	}
+
+	l.value--
+	return l.value == 0
+}
+
+// enable updates the length enable flag, enabling it while the next frame
+// sequencer step doesn't clock the length counters causes an extra clock.
+// It returns true when the extra clock expired the counter.
+func (l *lengthCounter) enable(on, lengthClockNext bool) bool {
+	wasEnabled := l.enabled
+	l.enabled = on
+	if wasEnabled || !on || lengthClockNext {
+		return false
+	}
+
+	return l.clock()
+}
+
+// trigger reloads an expired counter, with the same extra clock quirk as
+// enable.
+func (l *lengthCounter) trigger(lengthClockNext bool) {
+	if l.value != 0 {
+		return
+	}
+
+	l.value = l.max
+	if l.enabled && !lengthClockNext {
+		l.value--
+	}
+}
+
+var dutyPatterns = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
 }
 
 type pulse struct {
@@ -83,55 +353,201 @@ type pulse struct {
 	FreqHi         uint8 // 0xFF14/0xFF19 - NR14/NR24 - Channel 1/2 Frequency hi (R/W)
 
 	isPulse1 bool
+
+	enabled  bool
+	length   lengthCounter
+	envelope envelope
+	timer    uint16
+	dutyStep uint8
+
+	sweepEnabled bool
+	sweepTimer   uint8
+	sweepNegated bool
+	shadowFreq   uint16
+}
+
+func (p *pulse) dacEnabled() bool {
+	return p.VolumeEnvelope&0xF8 > 0
+}
+
+func (p *pulse) frequency() uint16 {
+	return uint16(p.FreqHi&0x07)<<8 | uint16(p.FreqLo)
 }
 
-func (p *pulse) clock(gb *GameBoy) {}
-func (p *pulse) sample() float64   { return 0 }
+func (p *pulse) setFrequency(f uint16) {
+	p.FreqLo = uint8(f)
+	p.FreqHi = p.FreqHi&^0x07 | uint8(f>>8)&0x07
+}
+
+// period returns the number of clocks between duty steps.
+func (p *pulse) period() uint16 {
+	return (2048 - p.frequency()) * 4
+}
+
+func (p *pulse) clock(gb *GameBoy) {
+	if !p.enabled {
+		return
+	}
+
+	p.timer--
+	if p.timer > 0 {
+		return
+	}
+
+	p.timer = p.period()
+	p.dutyStep = (p.dutyStep + 1) % 8
+}
+
+func (p *pulse) clockLength() {
+	if p.length.clock() {
+		p.enabled = false
+	}
+}
+
+func (p *pulse) clockEnvelope() {
+	p.envelope.clock(p.VolumeEnvelope)
+}
+
+func (p *pulse) clockSweep() {
+	if p.sweepTimer > 0 {
+		p.sweepTimer--
+	}
+	if p.sweepTimer > 0 {
+		return
+	}
+
+	p.sweepTimer = p.sweepPeriod()
+	if !p.sweepEnabled || p.Sweep>>4&0x07 == 0 {
+		return
+	}
+
+	freq := p.sweepCalc()
+	if freq > 2047 || p.Sweep&0x07 == 0 {
+		return
+	}
+
+	p.shadowFreq = freq
+	p.setFrequency(freq)
+
+	// the new frequency is checked again for overflow, but not used
+	p.sweepCalc()
+}
+
+// sweepPeriod returns the sweep timer reload value, a period of 0 is treated
+// as 8.
+func (p *pulse) sweepPeriod() uint8 {
+	period := p.Sweep >> 4 & 0x07
+	if period == 0 {
+		return 8
+	}
+	return period
+}
+
+// sweepCalc computes the next frequency, disabling the channel on overflow.
+func (p *pulse) sweepCalc() uint16 {
+	delta := p.shadowFreq >> (p.Sweep & 0x07)
+
+	var freq uint16
+	if p.Sweep&0x08 > 0 {
+		freq = p.shadowFreq - delta
+		p.sweepNegated = true
+	} else {
+		freq = p.shadowFreq + delta
+	}
+
+	if freq > 2047 {
+		p.enabled = false
+	}
+
+	return freq
+}
+
+func (p *pulse) trigger(lengthClockNext bool) {
+	p.enabled = p.dacEnabled()
+	p.length.trigger(lengthClockNext)
+	p.envelope.trigger(p.VolumeEnvelope)
+
+	// the low 2 bits of the timer are left untouched
+	p.timer = p.period() | p.timer&0x03
+
+	if !p.isPulse1 {
+		return
+	}
+
+	p.shadowFreq = p.frequency()
+	p.sweepTimer = p.sweepPeriod()
+	p.sweepNegated = false
+	p.sweepEnabled = p.Sweep&0x77 > 0
+	if p.Sweep&0x07 > 0 {
+		p.sweepCalc()
+	}
+}
+
+func (p *pulse) sample() float64 {
+	if !p.dacEnabled() {
+		return 0
+	}
+
+	var v uint8
+	if p.enabled {
+		v = dutyPatterns[p.Length>>6][p.dutyStep] * p.envelope.volume
+	}
+
+	return float64(v)/7.5 - 1
+}
 
 func (p *pulse) read(addr uint16) uint8 {
 	if p.isPulse1 {
 		switch addr {
 		case 0xFF10:
-			return p.Sweep
+			return p.Sweep | 0x80
 		case 0xFF11:
-			return p.Length
+			return p.Length | 0x3F
 		case 0xFF12:
 			return p.VolumeEnvelope
+		case 0xFF13:
+			return 0xFF
 		case 0xFF14:
-			return p.FreqHi
+			return p.FreqHi | 0xBF
 		}
 		// panic(fmt.Sprintf("unhandled pulse1 read 0x%04X", addr))
 	}
 
 	switch addr {
 	case 0xFF16:
-		return p.Length
+		return p.Length | 0x3F
 	case 0xFF17:
 		return p.VolumeEnvelope
+	case 0xFF18:
+		return 0xFF
 	case 0xFF19:
-		return p.FreqHi
+		return p.FreqHi | 0xBF
 	}
 	// panic(fmt.Sprintf("unhandled pulse2 read 0x%04X", addr))
 	return 0
 }
 
-func (p *pulse) write(addr uint16, v uint8) {
+func (p *pulse) write(addr uint16, v uint8, lengthClockNext bool) {
 	if p.isPulse1 {
 		switch addr {
 		case 0xFF10:
-			p.Sweep = v
+			p.Sweep = v & 0x7F
+			// clearing negate after a calculation used it disables the channel
+			if p.Sweep&0x08 == 0 && p.sweepNegated {
+				p.enabled = false
+			}
 			return
 		case 0xFF11:
-			p.Length = v
+			p.writeLength(v)
 			return
 		case 0xFF12:
-			p.VolumeEnvelope = v
+			p.writeEnvelope(v)
 			return
 		case 0xFF13:
 			p.FreqLo = v
 			return
 		case 0xFF14:
-			p.FreqHi = v
+			p.writeFreqHi(v, lengthClockNext)
 			return
 		}
 		// panic(fmt.Sprintf("unhandled pulse1 write 0x%04X: 0x%02X", addr, v))
@@ -139,21 +555,43 @@ func (p *pulse) write(addr uint16, v uint8) {
 
 	switch addr {
 	case 0xFF16:
-		p.Length = v
+		p.writeLength(v)
 		return
 	case 0xFF17:
-		p.VolumeEnvelope = v
+		p.writeEnvelope(v)
 		return
 	case 0xFF18:
 		p.FreqLo = v
 		return
 	case 0xFF19:
-		p.FreqHi = v
+		p.writeFreqHi(v, lengthClockNext)
 		return
 	}
 	// panic(fmt.Sprintf("unhandled pulse2 write 0x%04X: 0x%02X", addr, v))
 }
 
+func (p *pulse) writeLength(v uint8) {
+	p.Length = v & 0xC0
+	p.length.load(v & 0x3F)
+}
+
+func (p *pulse) writeEnvelope(v uint8) {
+	p.VolumeEnvelope = v
+	if !p.dacEnabled() {
+		p.enabled = false
+	}
+}
+
+func (p *pulse) writeFreqHi(v uint8, lengthClockNext bool) {
+	p.FreqHi = v & 0xC7
+	if p.length.enable(v&0x40 > 0, lengthClockNext) && v&0x80 == 0 {
+		p.enabled = false
+	}
+	if v&0x80 > 0 {
+		p.trigger(lengthClockNext)
+	}
+}
+
 type wave struct {
 	OnOff       uint8     // 0xFF1A - NR30 - Channel 3 Sound on/off (R/W)
 	Length      uint8     // 0xFF1B - NR31 - Channel 3 Sound Length
@@ -161,52 +599,167 @@ type wave struct {
 	FreqLo      uint8     // 0xFF1D - NR33 - Channel 3 Frequency's lower data (W)
 	FreqHi      uint8     // 0xFF1E - NR34 - Channel 3 Frequency's higher data (R/W)
 	Pattern     [16]uint8 // 0xFF30-0xFF3F - Wave Pattern RAM
+
+	enabled      bool
+	length       lengthCounter
+	timer        uint16
+	position     uint8
+	sampleBuffer uint8
+	justRead     bool
+}
+
+func (w *wave) dacEnabled() bool {
+	return w.OnOff&0x80 > 0
+}
+
+func (w *wave) frequency() uint16 {
+	return uint16(w.FreqHi&0x07)<<8 | uint16(w.FreqLo)
+}
+
+// period returns the number of clocks between samples.
+func (w *wave) period() uint16 {
+	return (2048 - w.frequency()) * 2
+}
+
+func (w *wave) volumeShift() uint8 {
+	switch w.OutputLevel >> 5 & 0x03 {
+	case 0:
+		return 4
+	case 1:
+		return 0
+	case 2:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (w *wave) clock(gb *GameBoy) {
+	w.justRead = false
+	if !w.enabled {
+		return
+	}
+
+	w.timer--
+	if w.timer > 0 {
+		return
+	}
+
+	w.timer = w.period()
+	w.position = (w.position + 1) % 32
+	w.sampleBuffer = w.Pattern[w.position/2]
+	w.justRead = true
+}
+
+func (w *wave) clockLength() {
+	if w.length.clock() {
+		w.enabled = false
+	}
 }
 
-func (w *wave) clock(gb *GameBoy) {}
-func (w *wave) sample() float64   { return 0 }
+func (w *wave) trigger(lengthClockNext bool) {
+	// on the DMG, retriggering while the channel is about to read a sample
+	// corrupts the first bytes of wave ram with the ones being read
+	if w.enabled && w.timer == 2 {
+		pos := (w.position + 1) % 32 / 2
+		if pos < 4 {
+			w.Pattern[0] = w.Pattern[pos]
+		} else {
+			copy(w.Pattern[0:4], w.Pattern[pos&^3:pos&^3+4])
+		}
+	}
+
+	w.enabled = w.dacEnabled()
+	w.length.trigger(lengthClockNext)
+	// the first sample is read 6 clocks later than the period would suggest
+	w.timer = w.period() + 6
+	w.position = 0
+}
+
+func (w *wave) sample() float64 {
+	if !w.dacEnabled() {
+		return 0
+	}
+
+	var v uint8
+	if w.enabled {
+		v = w.sampleBuffer
+		if w.position%2 == 0 {
+			v >>= 4
+		}
+		v = v & 0x0F >> w.volumeShift()
+	}
+
+	return float64(v)/7.5 - 1
+}
 
 func (w *wave) read(addr uint16) uint8 {
 	if addr >= 0xFF30 && addr <= 0xFF3F {
+		// while playing, the DMG only allows access to the byte being read
+		// and only on the same clock the channel reads it
+		if w.enabled {
+			if !w.justRead {
+				return 0xFF
+			}
+			return w.Pattern[w.position/2]
+		}
 		return w.Pattern[addr-0xFF30]
 	}
 
 	switch addr {
 	case 0xFF1A:
-		return w.OnOff
+		return w.OnOff | 0x7F
 	case 0xFF1B:
-		return w.Length
+		return 0xFF
 	case 0xFF1C:
-		return w.OutputLevel
+		return w.OutputLevel | 0x9F
+	case 0xFF1D:
+		return 0xFF
 	case 0xFF1E:
-		return w.FreqHi
+		return w.FreqHi | 0xBF
 	}
 
 	// panic(fmt.Sprintf("unhandled wave read 0x%04X", addr))
 	return 0
 }
 
-func (w *wave) write(addr uint16, v uint8) {
+func (w *wave) write(addr uint16, v uint8, lengthClockNext bool) {
 	if addr >= 0xFF30 && addr <= 0xFF3F {
-		w.Pattern[0xFF30-addr] = v
+		if w.enabled {
+			if w.justRead {
+				w.Pattern[w.position/2] = v
+			}
+			return
+		}
+		w.Pattern[addr-0xFF30] = v
 		return
 	}
 
 	switch addr {
 	case 0xFF1A:
-		w.OnOff = v
+		w.OnOff = v & 0x80
+		if !w.dacEnabled() {
+			w.enabled = false
+		}
 		return
 	case 0xFF1B:
 		w.Length = v
+		w.length.load(v)
 		return
 	case 0xFF1C:
-		w.OutputLevel = v
+		w.OutputLevel = v & 0x60
 		return
 	case 0xFF1D:
 		w.FreqLo = v
 		return
 	case 0xFF1E:
-		w.FreqHi = v
+		w.FreqHi = v & 0xC7
+		if w.length.enable(v&0x40 > 0, lengthClockNext) && v&0x80 == 0 {
+			w.enabled = false
+		}
+		if v&0x80 > 0 {
+			w.trigger(lengthClockNext)
+		}
 		return
 	}
 
@@ -218,21 +771,98 @@ type noise struct {
 	VolumeEnvelope uint8 // 0xFF21 - NR42 - Channel 4 Volume Envelope (R/W)
 	Counter        uint8 // 0xFF22 - NR43 - Channel 4 Polynomial Counter (R/W)
 	CounterLoad    uint8 // 0xFF23 - NR44 - Channel 4 Counter/consecutive; Inital (R/W)
+
+	enabled  bool
+	length   lengthCounter
+	envelope envelope
+	timer    uint32
+	lfsr     uint16
+}
+
+func (n *noise) dacEnabled() bool {
+	return n.VolumeEnvelope&0xF8 > 0
+}
+
+// period returns the number of clocks between lfsr shifts.
+//
+//	Bit 7-4 - Shift Clock Frequency (s)
+//	Bit 2-0 - Dividing Ratio of Frequencies (r), 0 is treated as 0.5
+func (n *noise) period() uint32 {
+	divisor := uint32(n.Counter&0x07) * 16
+	if divisor == 0 {
+		divisor = 8
+	}
+
+	return divisor << (n.Counter >> 4)
+}
+
+func (n *noise) clock(gb *GameBoy) {
+	if !n.enabled {
+		return
+	}
+
+	n.timer--
+	if n.timer > 0 {
+		return
+	}
+
+	n.timer = n.period()
+
+	// shift clock frequencies 14 and 15 don't clock the lfsr
+	if n.Counter>>4 >= 14 {
+		return
+	}
+
+	xor := (n.lfsr ^ n.lfsr>>1) & 0x01
+	n.lfsr = n.lfsr>>1 | xor<<14
+
+	// 7 bit mode, the result is also placed in bit 6
+	if n.Counter&0x08 > 0 {
+		n.lfsr = n.lfsr&^(1<<6) | xor<<6
+	}
 }
 
-func (n *noise) clock(gb *GameBoy) {}
-func (n *noise) sample() float64   { return 0 }
+func (n *noise) clockLength() {
+	if n.length.clock() {
+		n.enabled = false
+	}
+}
+
+func (n *noise) clockEnvelope() {
+	n.envelope.clock(n.VolumeEnvelope)
+}
+
+func (n *noise) trigger(lengthClockNext bool) {
+	n.enabled = n.dacEnabled()
+	n.length.trigger(lengthClockNext)
+	n.envelope.trigger(n.VolumeEnvelope)
+	n.timer = n.period()
+	n.lfsr = 0x7FFF
+}
+
+func (n *noise) sample() float64 {
+	if !n.dacEnabled() {
+		return 0
+	}
+
+	var v uint8
+	if n.enabled {
+		v = uint8(^n.lfsr&0x01) * n.envelope.volume
+	}
+
+	return float64(v)/7.5 - 1
+}
 
 func (n *noise) read(addr uint16) uint8 {
 	switch addr {
 	case 0xFF20:
-		return n.Length
+		return 0xFF
 	case 0xFF21:
 		return n.VolumeEnvelope
 	case 0xFF22:
 		return n.Counter
 	case 0xFF23:
-		return n.CounterLoad
+		return n.CounterLoad | 0xBF
 	}
 
 	// panic(fmt.Sprintf("unhandled noise read 0x%04X", addr))
@@ -240,21 +870,67 @@ func (n *noise) read(addr uint16) uint8 {
 
 }
 
-func (n *noise) write(addr uint16, v uint8) {
+func (n *noise) write(addr uint16, v uint8, lengthClockNext bool) {
 	switch addr {
 	case 0xFF20:
-		n.Length = v
+		n.Length = v & 0x3F
+		n.length.load(v & 0x3F)
 		return
 	case 0xFF21:
 		n.VolumeEnvelope = v
+		if !n.dacEnabled() {
+			n.enabled = false
+		}
 		return
 	case 0xFF22:
 		n.Counter = v
 		return
 	case 0xFF23:
-		n.CounterLoad = v
+		n.CounterLoad = v & 0xC0
+		if n.length.enable(v&0x40 > 0, lengthClockNext) && v&0x80 == 0 {
+			n.enabled = false
+		}
+		if v&0x80 > 0 {
+			n.trigger(lengthClockNext)
+		}
 		return
 	}
 
 	// panic(fmt.Sprintf("unhandled noise write 0x%04X: 0x%02X", addr, v))
 }
+
+// envelope is the volume envelope shared by the pulse and noise channels.
+//
+//	Bit 7-4 - Initial Volume of envelope (0-0Fh) (0=No Sound)
+//	Bit 3   - Envelope Direction (0=Decrease, 1=Increase)
+//	Bit 2-0 - Number of envelope sweep (n: 0-7) (If zero, stop envelope operation.)
+type envelope struct {
+	volume uint8
+	timer  uint8
+}
+
+func (e *envelope) trigger(nrx2 uint8) {
+	e.volume = nrx2 >> 4
+	e.timer = nrx2 & 0x07
+}
+
+func (e *envelope) clock(nrx2 uint8) {
+	period := nrx2 & 0x07
+	if period == 0 {
+		return
+	}
+
+	if e.timer > 0 {
+		e.timer--
+	}
+	if e.timer > 0 {
+		return
+	}
+
+	e.timer = period
+	if nrx2&0x08 > 0 && e.volume < 15 {
+		e.volume++
+	} else if nrx2&0x08 == 0 && e.volume > 0 {
+		e.volume--
+	}
+}
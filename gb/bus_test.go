@@ -78,3 +78,51 @@ func TestRamMap(t *testing.T) {
 		t.Errorf("hram: got 0x%02X, want 0x%02X", got, want)
 	}
 }
+
+func TestAccessRestrictions(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         ppuMode
+		dma          bool
+		unrestricted bool
+		vram, oam    bool // accessible
+	}{
+		{"hblank", modeHblank, false, false, true, true},
+		{"vblank", modeVblank, false, false, true, true},
+		{"oam search", modeOam, false, false, true, false},
+		{"transfer", modeTransfer, false, false, false, false},
+		{"dma", modeHblank, true, false, true, false},
+		{"unrestricted", modeTransfer, true, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := GameBoy{UnrestrictedAccess: tt.unrestricted}
+			gb.PowerOn()
+			gb.ppu.VRAM[0] = 0x42
+			gb.ppu.OAM[0] = 0x42
+			gb.ppu.STAT.setMode(tt.mode)
+			gb.dmaCtrl.active = tt.dma
+
+			check := func(what string, addr uint16, accessible bool) {
+				want := uint8(0xFF)
+				if accessible {
+					want = 0x42
+				}
+				if got := gb.read(addr); got != want {
+					t.Errorf("%s: got 0x%02X, want 0x%02X", what, got, want)
+				}
+
+				gb.write(addr, 0x10)
+				want = 0x42
+				if accessible {
+					want = 0x10
+				}
+				if got := gb.ppu.read(addr); got != want {
+					t.Errorf("%s: got 0x%02X after writing, want 0x%02X", what, got, want)
+				}
+			}
+			check("vram", 0x8000, tt.vram)
+			check("oam", 0xFE00, tt.oam)
+		})
+	}
+}
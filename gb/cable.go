@@ -0,0 +1,75 @@
+package gb
+
+// Cable is a link cable between two GameBoys running in the same process.
+// Both consoles must be driven through the cable, which keeps them in
+// lockstep, and the console using the external clock shifts each bit as the
+// other one does, so both ends of a transfer finish together.
+type Cable struct {
+	a, b *GameBoy
+}
+
+// NewCable connects a and b, replacing whatever was plugged into their
+// serial ports.
+func NewCable(a, b *GameBoy) *Cable {
+	a.Connect(cableEnd{peer: b})
+	b.Connect(cableEnd{peer: a})
+
+	return &Cable{a: a, b: b}
+}
+
+// Disconnect unplugs the cable from both consoles.
+func (c *Cable) Disconnect() {
+	c.a.Connect(nil)
+	c.b.Connect(nil)
+}
+
+// ClockFrame runs both consoles for a frame, always stepping the one that is
+// behind, and returns their frames.
+func (c *Cable) ClockFrame() (a, b []uint8) {
+	startA, startB := c.a.machineCycles, c.b.machineCycles
+	for {
+		elapsedA := c.a.machineCycles - startA
+		elapsedB := c.b.machineCycles - startB
+		if elapsedA >= 17556 && elapsedB >= 17556 {
+			break
+		}
+
+		if elapsedA <= elapsedB {
+			c.a.ExecuteInst()
+		} else {
+			c.b.ExecuteInst()
+		}
+	}
+
+	return c.a.ppu.frame[:], c.b.ppu.frame[:]
+}
+
+// cableEnd is plugged into one console and clocks transfers into the other,
+// a bit at a time.
+type cableEnd struct {
+	peer *GameBoy
+}
+
+func (e cableEnd) Transfer(out uint8) uint8 {
+	s := e.peerSerial()
+	if s == nil {
+		return 0xFF
+	}
+
+	return s.startExternal(out)
+}
+
+func (e cableEnd) clockBit() {
+	if s := e.peerSerial(); s != nil {
+		s.externalBit(e.peer)
+	}
+}
+
+func (e cableEnd) peerSerial() *serial {
+	if e.peer == nil {
+		return nil
+	}
+
+	s, _ := e.peer.serial.(*serial)
+	return s
+}
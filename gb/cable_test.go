@@ -0,0 +1,93 @@
+package gb
+
+import "testing"
+
+// serialRom sends sb with the given serial control, waits for the transfer to
+// finish and stores what it got at 0xC000.
+func serialRom(sb, sc uint8) *Cartridge {
+	rom := make(rom, 0x8000)
+	copy(rom[0x100:], []uint8{
+		0x3E, sb, // ld a, sb
+		0xE0, 0x01, // ldh (SB), a
+		0x3E, sc, // ld a, sc
+		0xE0, 0x02, // ldh (SC), a
+		0xF0, 0x02, // ldh a, (SC)
+		0xCB, 0x7F, // bit 7, a
+		0x20, 0xFA, // jr nz, -6
+		0xF0, 0x01, // ldh a, (SB)
+		0xEA, 0x00, 0xC0, // ld (0xC000), a
+		0x18, 0xFE, // jr -2
+	})
+
+	return &Cartridge{mbc: mbc0{rom: rom}}
+}
+
+func TestCable(t *testing.T) {
+	tests := []struct {
+		name       string
+		slaveSC    uint8
+		gotA, gotB uint8
+		slaveIntr  bool // the slave raises the serial interrupt
+	}{
+		{"transfer", 0x80, 0x99, 0x42, true},
+		{"slave not listening", 0x00, 0xFF, 0x99, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a, b GameBoy
+			if err := a.InsertCartridge(serialRom(0x42, 0x81), nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.InsertCartridge(serialRom(0x99, tt.slaveSC), nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			a.PowerOn()
+			b.PowerOn()
+
+			cable := NewCable(&a, &b)
+
+			// step the consoles the way ClockFrame does until the master's
+			// transfer is over, noting when each one raises the interrupt
+			var intrA, intrB uint64
+			for intrA == 0 {
+				if a.machineCycles <= b.machineCycles {
+					a.ExecuteInst()
+				} else {
+					b.ExecuteInst()
+				}
+				if intrA == 0 && a.interruptCtrl.IF&serialInterrupt > 0 {
+					intrA = a.machineCycles
+				}
+				if intrB == 0 && b.interruptCtrl.IF&serialInterrupt > 0 {
+					intrB = b.machineCycles
+				}
+			}
+			switch diff := int64(intrA) - int64(intrB); {
+			case !tt.slaveIntr && intrB != 0:
+				t.Error("slave raised the serial interrupt")
+			case tt.slaveIntr && intrB == 0:
+				t.Error("slave didn't raise the serial interrupt")
+			case tt.slaveIntr && (diff < -8 || diff > 8):
+				t.Errorf("slave interrupt %d machine cycles away from the master's", diff)
+			}
+
+			cable.ClockFrame()
+
+			if diff := int64(a.machineCycles) - int64(b.machineCycles); diff < -8 || diff > 8 {
+				t.Errorf("consoles drifted %d machine cycles apart", diff)
+			}
+
+			if got := a.read(0xC000); got != tt.gotA {
+				t.Errorf("master got 0x%02X, want 0x%02X", got, tt.gotA)
+			}
+			if got := b.read(0xC000); got != tt.gotB {
+				t.Errorf("slave got 0x%02X, want 0x%02X", got, tt.gotB)
+			}
+
+			cable.Disconnect()
+			if a.link != nil || b.link != nil {
+				t.Error("cable still connected")
+			}
+		})
+	}
+}
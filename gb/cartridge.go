@@ -42,6 +42,15 @@ func NewCartridge(r io.Reader) (*Cartridge, error) {
 	return ret, nil
 }
 
+// SetClock sets the source of wall clock time for carts with a real time
+// clock, nil means SystemClock. It must be called before inserting the
+// cartridge for the clock to catch up with the time stored in the save.
+func (c *Cartridge) SetClock(clk Clock) {
+	if m, ok := c.mbc.(clockedMbc); ok {
+		m.setClock(clk)
+	}
+}
+
 func (c *Cartridge) clock(gb *GameBoy) {
 	c.mbc.clock(gb)
 }
@@ -0,0 +1,166 @@
+package gb
+
+// Channel identifies one of the sound channels.
+type Channel int
+
+const (
+	Pulse1 Channel = iota
+	Pulse2
+	Wave
+	Noise
+)
+
+func (c Channel) String() string {
+	switch c {
+	case Pulse1:
+		return "pulse1"
+	case Pulse2:
+		return "pulse2"
+	case Wave:
+		return "wave"
+	case Noise:
+		return "noise"
+	default:
+		return "unknown"
+	}
+}
+
+func (c Channel) valid() bool {
+	return c >= Pulse1 && c <= Noise
+}
+
+// MuteChannel silences ch in the mix, the channel keeps running and still
+// shows up in recorded stems.
+func (gb *GameBoy) MuteChannel(ch Channel, mute bool) {
+	if gb == nil || gb.apu == nil || !ch.valid() {
+		return
+	}
+
+	gb.apu.muted[ch] = mute
+}
+
+// ChannelMuted reports whether ch was muted with MuteChannel.
+func (gb *GameBoy) ChannelMuted(ch Channel) bool {
+	if gb == nil || gb.apu == nil || !ch.valid() {
+		return false
+	}
+
+	return gb.apu.muted[ch]
+}
+
+// SoloChannel sets whether ch is soloed. While any channel is soloed, only
+// the soloed channels are heard in the mix.
+func (gb *GameBoy) SoloChannel(ch Channel, solo bool) {
+	if gb == nil || gb.apu == nil || !ch.valid() {
+		return
+	}
+
+	gb.apu.soloed[ch] = solo
+}
+
+// ChannelSoloed reports whether ch was soloed with SoloChannel.
+func (gb *GameBoy) ChannelSoloed(ch Channel) bool {
+	if gb == nil || gb.apu == nil || !ch.valid() {
+		return false
+	}
+
+	return gb.apu.soloed[ch]
+}
+
+// ChannelStatus is a snapshot of what a channel is doing.
+type ChannelStatus struct {
+	Enabled   bool    // Channel is playing
+	Audible   bool    // Channel is heard in the mix, taking mute and solo into account
+	Frequency float64 // Frequency of the tone in Hz, for the noise channel the rate the LFSR is clocked at
+	Volume    float64 // Current volume, in the [0, 1] range
+	Duty      float64 // Fraction of the waveform spent high, only set for the pulse channels
+}
+
+// ChannelStatus returns the current state of ch.
+func (gb *GameBoy) ChannelStatus(ch Channel) ChannelStatus {
+	if gb == nil || gb.apu == nil || !ch.valid() {
+		return ChannelStatus{}
+	}
+
+	a := gb.apu
+	st := ChannelStatus{
+		Audible: a.audible(int(ch)),
+	}
+
+	switch ch {
+	case Pulse1, Pulse2:
+		p := &a.p1
+		if ch == Pulse2 {
+			p = &a.p2
+		}
+		st.Enabled = p.enabled && p.dacEnabled()
+		st.Frequency = cpuFreq / float64(uint32(p.period())*8)
+		st.Volume = float64(p.envelope.volume) / 15
+		st.Duty = [4]float64{0.125, 0.25, 0.5, 0.75}[p.Length>>6]
+
+	case Wave:
+		w := &a.wave
+		st.Enabled = w.enabled && w.dacEnabled()
+		st.Frequency = cpuFreq / float64(uint32(w.period())*32)
+		st.Volume = float64(uint8(0x0F)>>w.volumeShift()) / 15
+
+	case Noise:
+		n := &a.noise
+		st.Enabled = n.enabled && n.dacEnabled()
+		st.Frequency = cpuFreq / float64(n.period())
+		st.Volume = float64(n.envelope.volume) / 15
+	}
+
+	if !a.powered() {
+		st.Enabled = false
+	}
+
+	return st
+}
+
+// ChannelScope appends the recent output of ch, oldest first, to dst and
+// returns it. It covers roughly one frame worth of audio, in the [-1, 1]
+// range.
+func (gb *GameBoy) ChannelScope(ch Channel, dst []float64) []float64 {
+	if gb == nil || gb.mixer == nil || !ch.valid() {
+		return dst
+	}
+
+	return gb.mixer.scope.read(ch, dst)
+}
+
+const (
+	scopeLen        = 4096
+	scopeDecimation = 4 // machine cycles averaged into every scope sample
+)
+
+// scope keeps the recent output of every channel.
+type scope struct {
+	buf [4][scopeLen]float64
+	pos int
+
+	sum   [4]float64
+	count int
+}
+
+func (s *scope) push(channels [4]float64) {
+	for i, v := range channels {
+		s.sum[i] += v
+	}
+	s.count++
+	if s.count < scopeDecimation {
+		return
+	}
+
+	for i := range s.sum {
+		s.buf[i][s.pos] = s.sum[i] / scopeDecimation
+		s.sum[i] = 0
+	}
+	s.count = 0
+	s.pos = (s.pos + 1) % scopeLen
+}
+
+func (s *scope) read(ch Channel, dst []float64) []float64 {
+	dst = append(dst, s.buf[ch][s.pos:]...)
+	return append(dst, s.buf[ch][:s.pos]...)
+}
@@ -0,0 +1,108 @@
+package gb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMuteSolo(t *testing.T) {
+	var gb GameBoy
+	gb.PowerOn()
+	gb.write(ioRegs.NR50, 0x77)
+	gb.write(ioRegs.NR51, 0xFF)
+
+	in := [4]float64{0.1, 0.2, 0.4, 0.8}
+
+	tests := []struct {
+		name  string
+		mute  [4]bool
+		solo  [4]bool
+		heard float64
+	}{
+		{"none", [4]bool{}, [4]bool{}, 1.5},
+		{"mute pulse2", [4]bool{false, true}, [4]bool{}, 1.3},
+		{"solo wave", [4]bool{}, [4]bool{false, false, true}, 0.4},
+		{"solo wave noise", [4]bool{}, [4]bool{false, false, true, true}, 1.2},
+		{"solo and mute noise", [4]bool{false, false, false, true}, [4]bool{false, false, true, true}, 0.4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for ch := Pulse1; ch <= Noise; ch++ {
+				gb.MuteChannel(ch, tt.mute[ch])
+				gb.SoloChannel(ch, tt.solo[ch])
+			}
+
+			// power cycling must not reset the user's choices
+			gb.PowerOn()
+			gb.write(ioRegs.NR50, 0x77)
+			gb.write(ioRegs.NR51, 0xFF)
+
+			for ch := Pulse1; ch <= Noise; ch++ {
+				if got := gb.ChannelMuted(ch); got != tt.mute[ch] {
+					t.Errorf("%v: got muted %v, want %v", ch, got, tt.mute[ch])
+				}
+				if got := gb.ChannelSoloed(ch); got != tt.solo[ch] {
+					t.Errorf("%v: got soloed %v, want %v", ch, got, tt.solo[ch])
+				}
+			}
+
+			l, r := gb.apu.mix(in)
+			if want := tt.heard / 4; math.Abs(l-want) > 1e-9 || math.Abs(r-want) > 1e-9 {
+				t.Errorf("got %v, %v, want %v", l, r, want)
+			}
+		})
+	}
+}
+
+func TestChannelStatus(t *testing.T) {
+	// spin in place at the entry point
+	rom := make(rom, 0x8000)
+	rom[0x100], rom[0x101] = 0x18, 0xFE // jr -2
+
+	var gb GameBoy
+	if err := gb.InsertCartridge(&Cartridge{mbc: mbc0{rom: rom}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gb.PowerOn()
+
+	// a4, 440Hz: 2048 - 131072/440
+	gb.write(ioRegs.NR21, 0x80)
+	gb.write(ioRegs.NR22, 0xA0)
+	gb.write(ioRegs.NR23, 0xD6)
+	gb.write(ioRegs.NR24, 0x86)
+
+	st := gb.ChannelStatus(Pulse2)
+	if !st.Enabled || !st.Audible {
+		t.Errorf("got %+v, want an enabled audible channel", st)
+	}
+	if math.Abs(st.Frequency-440) > 0.5 {
+		t.Errorf("got frequency %v, want ~440", st.Frequency)
+	}
+	if st.Volume != 10.0/15 {
+		t.Errorf("got volume %v, want %v", st.Volume, 10.0/15)
+	}
+	if st.Duty != 0.5 {
+		t.Errorf("got duty %v, want 0.5", st.Duty)
+	}
+
+	for i := 0; i < 2; i++ {
+		gb.ClockFrame()
+	}
+
+	scope := gb.ChannelScope(Pulse2, nil)
+	if len(scope) != scopeLen {
+		t.Fatalf("got %d scope samples, want %d", len(scope), scopeLen)
+	}
+
+	var high, low int
+	for _, v := range scope {
+		if v > 0 {
+			high++
+		} else if v < 0 {
+			low++
+		}
+	}
+	if high == 0 || low == 0 {
+		t.Errorf("scope is flat, %d high and %d low samples", high, low)
+	}
+}
@@ -6,6 +6,10 @@ const (
 	divFreq     = 16384
 )
 
+// FrameRate is how many frames the DMG renders per second, 70224 clocks per
+// frame at 4194304Hz, ~59.73Hz.
+const FrameRate = cpuFreq / 70224.0
+
 var ioRegs = struct {
 	// joypad
 	P1 uint16
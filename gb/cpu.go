@@ -126,16 +126,34 @@ func (c *cpu) init(pc uint16) {
 }
 
 func (c *cpu) readFrom(gb *GameBoy, addr uint16) uint8 {
+	gb.ppu.oamBug(oamBugRead, addr)
+	v := gb.read(addr)
+	gb.clockCompensate()
+	return v
+}
+
+// readIncFrom reads addr while incrementing or decrementing it in the same
+// cycle.
+func (c *cpu) readIncFrom(gb *GameBoy, addr uint16) uint8 {
+	gb.ppu.oamBug(oamBugReadInc, addr)
 	v := gb.read(addr)
 	gb.clockCompensate()
 	return v
 }
 
 func (c *cpu) writeTo(gb *GameBoy, addr uint16, v uint8) {
+	gb.ppu.oamBug(oamBugWrite, addr)
 	gb.write(addr, v)
 	gb.clockCompensate()
 }
 
+// incDecCycle runs an internal cycle that increments or decrements addr.
+// Nothing is read or written, but addr still ends up on the bus.
+func (c *cpu) incDecCycle(gb *GameBoy, addr uint16) {
+	gb.ppu.oamBug(oamBugWrite, addr)
+	gb.clockCompensate()
+}
+
 func (c *cpu) clock(gb *GameBoy) {
 	switch {
 	// case gb.state&dma > 0:
@@ -167,23 +185,25 @@ func (c *cpu) clock(gb *GameBoy) {
 			gb.state = interruptDispatch
 		}
 	case gb.state&interruptDispatch > 0:
-		// TODO: we might be missing a cycle here (if the 1st cycle is not the PC fetch)
 		var vector uint16
 
+		// 5 cycles: an idle one, the two pushes and two more to jump
 		c.IME = false
+		gb.clockCompensate()
 
 		c.SP--
 		c.writeTo(gb, c.SP, uint8(c.PC>>8))
+
+		// the interrupt is picked after pushing the high byte, which can
+		// overwrite IE. If nothing is left the dispatch jumps to 0x0000.
+		intType := gb.interruptCtrl.raised(anyInterrupt)
+
 		c.SP--
 		c.writeTo(gb, c.SP, uint8(c.PC&0xFF))
 
 		gb.clockCompensate()
 		gb.clockCompensate()
 
-		intType := gb.interruptCtrl.raised(anyInterrupt)
-		if intType == 0 {
-			panic("no ints available")
-		}
 		switch {
 		case intType&vblankInterrupt > 0:
 			vector = vectorVBlank
@@ -767,17 +787,16 @@ func (c *cpu) dec_rr(opcode uint8, gb *GameBoy) {
 	}
 
 	v := uint16(*rrhi)<<8 | uint16(*rrlo)
+	c.incDecCycle(gb, v)
 	v--
 	*rrhi = uint8(v >> 8)
 	*rrlo = uint8(v & 0xFF)
-
-	c.readFrom(gb, c.PC) // TODO: what actually gets read (or written)?
 }
 
 // 0x3B DEC SP  1 8 0 - - - -
 func (c *cpu) dec_sp(opcode uint8, gb *GameBoy) {
+	c.incDecCycle(gb, c.SP)
 	c.SP--
-	c.readFrom(gb, c.PC) // TODO: what actually gets read (or written)?
 }
 
 // 0xF3 DI      1 4 0 - - - -
@@ -877,17 +896,16 @@ func (c *cpu) inc_rr(opcode uint8, gb *GameBoy) {
 	}
 
 	v := uint16(*rrhi)<<8 | uint16(*rrlo)
+	c.incDecCycle(gb, v)
 	v++
 	*rrhi = uint8(v >> 8)
 	*rrlo = uint8(v & 0xFF)
-
-	c.readFrom(gb, c.PC) // TODO: what actually gets read (or written)?
 }
 
 // 0x33 INC SP  1 8 0 - - - -
 func (c *cpu) inc_sp(opcode uint8, gb *GameBoy) {
+	c.incDecCycle(gb, c.SP)
 	c.SP++
-	c.readFrom(gb, c.SP) // TODO: what actually gets read (or written)?
 }
 
 // 0xD2 JP NC,a16       3 16 12 - - - -
@@ -1145,7 +1163,7 @@ func (c *cpu) ld_irr_r(opcode uint8, gb *GameBoy) {
 // 0x3A LD A,(HL-)      1 8 0 - - - -
 func (c *cpu) ld_r_hlid(opcode uint8, gb *GameBoy) {
 	addr := uint16(c.H)<<8 | uint16(c.L)
-	c.A = c.readFrom(gb, addr)
+	c.A = c.readIncFrom(gb, addr)
 
 	switch opcode {
 	case 0x2A:
@@ -1638,7 +1656,7 @@ func (c *cpu) pop_rr(opcode uint8, gb *GameBoy) {
 		isf = true
 	}
 
-	*rrlo = c.readFrom(gb, c.SP)
+	*rrlo = c.readIncFrom(gb, c.SP)
 	if isf {
 		*rrlo &= 0xF0
 	}
@@ -1676,7 +1694,7 @@ func (c *cpu) push_rr(opcode uint8, gb *GameBoy) {
 		rrlo = (*uint8)(&c.F)
 	}
 
-	c.readFrom(gb, c.SP) // TODO: what actually gets read (or written)?
+	c.incDecCycle(gb, c.SP)
 
 	c.SP--
 	c.writeTo(gb, c.SP, *rrhi)
@@ -1864,7 +1882,7 @@ func (c *cpu) rst(opcode uint8, gb *GameBoy) {
 		addr = 0x38
 	}
 
-	_ = c.readFrom(gb, c.SP)
+	c.incDecCycle(gb, c.SP)
 
 	c.SP--
 	c.writeTo(gb, c.SP, uint8(c.PC>>8))
@@ -1,19 +1,42 @@
 package gb
 
+// dmaStartDelay counts the cycle DMA is written in, the copy starts the one
+// after the next.
+const dmaStartDelay = 2
+
+// dmaCtrl copies 160 bytes to oam, one per cycle. The copy starts a cycle
+// after the write to DMA, and oam is busy for the cpu until it ends. Writing
+// again while copying restarts the transfer, oam stays busy meanwhile.
 type dmaCtrl struct {
 	src    uint16
 	target uint16
+	active bool
+
+	next  uint16 // source of the transfer about to start
+	start int    // cycles until it starts
 }
 
 func (d *dmaCtrl) clock(gb *GameBoy) {
-	if gb.state&dma > 0 {
-		v := gb.read(d.src)
-		// fmt.Printf("dma transfer 0x%04X -> 0x%04X (0x%02X)\n", d.src, d.target, v)
-		gb.ppu.write(d.target, v)
+	if d.active {
+		// the upper half of the address space reads from wram instead
+		src := d.src
+		if src >= 0xE000 {
+			src -= 0x2000
+		}
+		gb.ppu.write(d.target, gb.read(src))
 		d.src++
 		d.target++
 		if d.target > 0xFE9F {
-			gb.state &^= dma
+			d.active = false
+		}
+	}
+
+	if d.start > 0 {
+		d.start--
+		if d.start == 0 {
+			d.active = true
+			d.src = d.next
+			d.target = 0xFE00
 		}
 	}
 }
@@ -21,13 +44,18 @@ func (d *dmaCtrl) clock(gb *GameBoy) {
 func (d *dmaCtrl) write(addr uint16, v uint8) {
 	switch addr {
 	case ioRegs.DMA:
-		d.src = uint16(v) << 8
-		d.target = 0xFE00
+		d.next = uint16(v) << 8
+		d.start = dmaStartDelay
+		return
 	}
 	unmappedWrite("dma controller", addr, v)
 }
 
 func (d *dmaCtrl) read(addr uint16) uint8 {
+	switch addr {
+	case ioRegs.DMA:
+		return uint8(d.next >> 8)
+	}
 	unmappedRead("dma controller", addr)
 	return 0
 }
@@ -0,0 +1,307 @@
+package gb
+
+import "image/color"
+
+// bgFIFO holds the background and window pixels waiting to be shifted out
+// to the lcd. The fetcher only pushes to it once it's empty, so it never
+// holds more than a tile row.
+type bgFIFO struct {
+	lo, hi uint8
+	n      uint8
+}
+
+func (f *bgFIFO) push(lo, hi uint8) {
+	f.lo, f.hi, f.n = lo, hi, 8
+}
+
+func (f *bgFIFO) pop() (idx uint8) {
+	idx = (f.hi>>7)<<1 | f.lo>>7
+	f.lo <<= 1
+	f.hi <<= 1
+	f.n--
+	return idx
+}
+
+func (f *bgFIFO) clear() {
+	f.n = 0
+}
+
+// spriteFIFO holds the sprite pixels waiting to be mixed with the background
+// and window, it's shifted out along with the bgFIFO. A sprite only fills the
+// slots the sprites fetched before it left transparent, which is what gives
+// sprites with a smaller X the priority.
+type spriteFIFO struct {
+	px [8]spritePixel
+	n  uint8
+}
+
+type spritePixel struct {
+	idx   uint8
+	flags spriteFlags
+}
+
+func (f *spriteFIFO) push(lo, hi uint8, flags spriteFlags) {
+	for i := range f.px {
+		idx := (hi>>7)<<1 | lo>>7
+		lo <<= 1
+		hi <<= 1
+
+		if uint8(i) < f.n && f.px[i].idx != 0 {
+			continue
+		}
+		f.px[i] = spritePixel{idx: idx, flags: flags}
+	}
+	f.n = 8
+}
+
+// pop returns a transparent pixel once the fifo is empty.
+func (f *spriteFIFO) pop() spritePixel {
+	if f.n == 0 {
+		return spritePixel{}
+	}
+
+	px := f.px[0]
+	copy(f.px[:], f.px[1:])
+	f.n--
+	return px
+}
+
+func (f *spriteFIFO) clear() {
+	f.n = 0
+}
+
+type fetcherStep uint8
+
+const (
+	fetchTile fetcherStep = iota
+	fetchLo
+	fetchHi
+	fetchPush
+)
+
+// fetcher reads the background and window tiles, a row of a tile at a time.
+// Every step but the push takes 2 dots, the push waits for the fifo to be
+// empty. The first tile of a line is fetched twice, the pixels of the first
+// fetch are shifted out off screen.
+type fetcher struct {
+	step   fetcherStep
+	dots   uint8
+	x      uint8 // tile column, relative to the start of the line or window
+	window bool
+
+	tile   uint8
+	lo, hi uint8
+}
+
+func (f *fetcher) clock(p *ppu) {
+	if f.step == fetchPush {
+		if p.bgFIFO.n > 0 {
+			return
+		}
+
+		p.bgFIFO.push(f.lo, f.hi)
+		if p.lx > 0 {
+			f.x++
+		}
+		f.step = fetchTile
+		return
+	}
+
+	f.dots++
+	if f.dots < 2 {
+		return
+	}
+	f.dots = 0
+
+	// registers are sampled as the fetch goes, so writes in the middle of a
+	// line take effect from the next tile on
+	switch f.step {
+	case fetchTile:
+		f.tile = f.tileIndex(p)
+		f.step = fetchLo
+
+	case fetchLo:
+		f.lo = p.read(f.rowAddr(p))
+		f.step = fetchHi
+
+	case fetchHi:
+		f.hi = p.read(f.rowAddr(p) + 1)
+		f.step = fetchPush
+	}
+}
+
+func (f *fetcher) tileIndex(p *ppu) uint8 {
+	if f.window {
+		return p.tileIndex(f.x*8, p.windowLine, true)
+	}
+
+	return p.tileIndex(f.x*8+p.SCX&^7, p.LY+p.SCY, false)
+}
+
+func (f *fetcher) rowAddr(p *ppu) uint16 {
+	row := p.LY + p.SCY
+	if f.window {
+		row = p.windowLine
+	}
+
+	return p.tileBaseAddr(f.tile) + uint16(row%8)*2
+}
+
+// transferStart is the dot of the line mode 3 starts at, right after the 80
+// dots of the oam search.
+const transferStart = 80
+
+// startTransfer gets ready to shift out a new line. The tile number of the
+// first fetch is read right away, so the last pixel is shifted out 172 dots
+// into mode 3 at the earliest.
+func (p *ppu) startTransfer() {
+	p.fetcher = fetcher{}
+	p.bgFIFO.clear()
+	p.spriteFIFO.clear()
+	p.lx = 0
+	p.discard = p.SCX % 8
+	p.stall = 0
+	p.inWindow = false
+	p.spritesFetched = 0
+	p.penaltyTiles = 0
+
+	// a window started at WX=166 covers the whole of the next line
+	if p.windowWrap && p.LCDC.windowEnabled() {
+		p.inWindow = true
+		p.fetcher = fetcher{window: true}
+	}
+	p.windowWrap = false
+
+	p.fetcher.tile = p.fetcher.tileIndex(p)
+	p.fetcher.step = fetchLo
+}
+
+// transfer runs a dot of mode 3: the fetcher fills the fifo, which shifts a
+// pixel out to the lcd every dot unless a sprite is being fetched. The
+// fine scroll is applied by dropping the first SCX%8 pixels of the first
+// tile on screen, so it delays the end of the mode by as many dots, and so
+// does restarting the fetcher for the window.
+func (p *ppu) transfer() {
+	// mode 0 (hblank) starts the dot after the last pixel
+	if p.lx == 168 {
+		if p.inWindow {
+			p.windowLine++
+		}
+		p.STAT.setMode(modeHblank)
+		p.hblankDelay = 3
+		return
+	}
+
+	if p.stall > 0 {
+		p.stall--
+		return
+	}
+
+	if p.fetchSprite() {
+		return
+	}
+
+	p.fetcher.clock(p)
+
+	// WX is the screen position plus 7, so WX 0-6 start the window while
+	// shifting out the pixels off the left of the screen, which clips it
+	if !p.inWindow && p.LCDC.windowEnabled() && p.wyMatched && p.WX <= 166 && p.lx == p.WX+1 {
+		p.inWindow = true
+		p.windowWrap = p.WX == 166
+		p.bgFIFO.clear()
+		p.fetcher = fetcher{window: true}
+		return
+	}
+
+	if p.bgFIFO.n == 0 {
+		return
+	}
+
+	idx := p.bgFIFO.pop()
+	if p.discard > 0 && p.lx >= 8 {
+		p.discard--
+		return
+	}
+
+	px := p.spriteFIFO.pop()
+	if p.lx >= 8 {
+		p.drawPixel(p.lx-8, idx, px)
+	}
+	p.lx++
+}
+
+// fetchSprite stalls the fifo when reaching a sprite in this line and loads
+// it into the sprite fifo. Fetching the sprite takes 6 dots, plus the time
+// the fetcher needs to finish the background tile the sprite starts in, if no
+// other sprite waited for it already.
+func (p *ppu) fetchSprite() bool {
+	if !p.LCDC.spriteEnabled() {
+		return false
+	}
+
+	for i := 0; i < p.spriteCount; i++ {
+		if p.spritesFetched&(1<<i) > 0 || p.sprites[i].x != p.lx {
+			continue
+		}
+		p.spritesFetched |= 1 << i
+
+		scroll := p.SCX
+		if p.inWindow {
+			scroll = 255 - p.WX
+		}
+
+		// sprites at X=0 share a tile of their own, where they always wait
+		// the longest
+		pos := uint(p.sprites[i].x) + uint(scroll)
+		tile, wait := pos/8, 5-int(pos%8)
+		if p.sprites[i].x == 0 {
+			tile, wait = 63, 5
+		}
+
+		penalty := 6
+		if p.penaltyTiles&(1<<tile) == 0 {
+			p.penaltyTiles |= 1 << tile
+			if wait > 0 {
+				penalty += wait
+			}
+		}
+
+		lo, hi := p.spriteRow(p.sprites[i])
+		p.spriteFIFO.push(lo, hi, p.sprites[i].flags)
+
+		// this dot is the first one of the fetch
+		p.stall = penalty - 1
+		return true
+	}
+
+	return false
+}
+
+// drawPixel mixes a background or window pixel with the sprite pixel shifted
+// out with it, using the palettes as they are now. Sprites with the priority
+// flag set are hidden by background colours 1-3.
+func (p *ppu) drawPixel(x, idx uint8, px spritePixel) {
+	if p.LCDC&lcdcPriority == 0 {
+		idx = 0
+	}
+
+	colour := p.paletteLookup(idx, p.BGP)
+	if (p.inWindow && p.hideWindow) || (!p.inWindow && p.hideBackground) {
+		colour = color.RGBA{}
+	}
+
+	visible := px.idx != 0 && (px.flags&spritePriority == 0 || idx == 0)
+	if visible && p.LCDC.spriteEnabled() && !p.hideSprites {
+		palette := p.OBP0
+		if px.flags&spriptePalette > 0 {
+			palette = p.OBP1
+		}
+		colour = p.paletteLookup(px.idx, palette)
+	}
+
+	offset := int(p.LY)*160*4 + int(x)*4
+	p.frame[offset+0] = colour.R
+	p.frame[offset+1] = colour.G
+	p.frame[offset+2] = colour.B
+	p.frame[offset+3] = colour.A
+}
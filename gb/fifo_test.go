@@ -0,0 +1,46 @@
+package gb
+
+import "testing"
+
+func TestMode3Length(t *testing.T) {
+	tests := []struct {
+		name    string
+		scx     uint8
+		sprites []uint8 // x of each sprite in the line
+		want    int
+	}{
+		{"no scroll", 0, nil, 173},
+		{"fine scroll", 3, nil, 176},
+		{"coarse scroll", 8, nil, 173},
+		{"sprite at 0", 0, []uint8{0}, 184},
+		{"sprites at 0", 0, []uint8{0, 0}, 190},
+		{"sprite aligned", 0, []uint8{8}, 184},
+		{"sprite unaligned", 0, []uint8{13}, 179},
+		{"sprites sharing a tile", 0, []uint8{8, 8}, 190},
+		{"scrolled sprite", 5, []uint8{8}, 184},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+			p := &ppu{LCDC: lcdcDisplayEnable | lcdcObjEnable | lcdcPriority, SCX: tt.scx}
+			for i, x := range tt.sprites {
+				p.OAM[i*4+0] = 16
+				p.OAM[i*4+1] = x
+			}
+
+			for p.clocks < transferStart {
+				p.clock(gb)
+			}
+			p.clock(gb)
+			dots := 1
+			for p.STAT&lcdStatMode == lcdStat(modeTransfer) {
+				p.clock(gb)
+				dots++
+			}
+
+			if dots != tt.want {
+				t.Errorf("got %d dots, want %d", dots, tt.want)
+			}
+		})
+	}
+}
@@ -16,7 +16,6 @@ const (
 	stop
 	halt
 	interruptDispatch
-	dma
 )
 
 func (s state) String() string {
@@ -45,13 +44,6 @@ func (s state) String() string {
 		}
 		out = append(out, []rune("dispatch")...)
 
-	}
-	if s&dma > 0 {
-		if len(out) > 0 {
-			out = append(out, '|')
-		}
-		out = append(out, []rune("dma")...)
-
 	}
 	return string(out)
 }
@@ -84,14 +76,31 @@ type GameBoy struct {
 	apu           *apu
 	ppu           *ppu
 	serial        busDevice
+	link          Link
 	cartridge     *Cartridge
 	joypad        *joypad
+	mixer         *mixer
+	vgm           *vgmLogger
 
 	hram hram
 	wram wram
 
 	machineCycles uint64
 	Debug         bool
+
+	// Clock is the source of wall clock time given to the carts inserted
+	// afterwards, nil means SystemClock. See Cartridge.SetClock.
+	Clock Clock
+
+	// Rumble is called when the rumble motor of the cartridge is turned on or
+	// off, for carts that have one.
+	Rumble func(on bool)
+
+	// UnrestrictedAccess lets the cpu access vram and oam while the ppu or
+	// the oam dma are using them, instead of reading 0xFF and dropping the
+	// writes. Games that get the timing wrong only break on hardware then,
+	// so it's only meant for debugging.
+	UnrestrictedAccess bool
 }
 
 func (gb *GameBoy) PowerOn() {
@@ -103,10 +112,25 @@ func (gb *GameBoy) PowerOn() {
 	gb.timer = &timer{}
 	gb.interruptCtrl = &interruptCtrl{}
 	gb.dmaCtrl = &dmaCtrl{}
-	gb.apu = &apu{p1: pulse{isPulse1: true}}
+	prevAPU := gb.apu
+	gb.apu = &apu{
+		OnOff: apuPower,
+		p1:    pulse{isPulse1: true, length: lengthCounter{max: 64}},
+		p2:    pulse{length: lengthCounter{max: 64}},
+		wave:  wave{length: lengthCounter{max: 256}},
+		noise: noise{length: lengthCounter{max: 64}},
+	}
+	if prevAPU != nil {
+		// mute and solo are set by the user, not the game
+		gb.apu.muted = prevAPU.muted
+		gb.apu.soloed = prevAPU.soloed
+	}
 	gb.ppu = &ppu{}
 	gb.serial = &serial{}
 	gb.joypad = &joypad{}
+	if gb.mixer == nil {
+		gb.mixer = newMixer()
+	}
 	// gb.cartridge =     cartridge{}
 
 	gb.cpu.init(0x0100)
@@ -171,6 +195,9 @@ func (gb *GameBoy) InsertCartridge(cart *Cartridge, savReader io.Reader, savWrit
 	}
 
 	gb.cartridge = cart
+	if gb.Clock != nil {
+		cart.SetClock(gb.Clock)
+	}
 	if !cart.Saveable() {
 		return nil
 	}
@@ -198,7 +225,48 @@ func (gb *GameBoy) CartridgeInfo() CartridgeInfo {
 	return gb.cartridge.CartridgeInfo
 }
 
-func (gb *GameBoy) SetVolume(vol float64) {}
+// SetVolume sets the output volume, in the [0, 1] range.
+func (gb *GameBoy) SetVolume(vol float64) {
+	if gb == nil {
+		return
+	}
+
+	if vol < 0 {
+		vol = 0
+	}
+	if vol > 1 {
+		vol = 1
+	}
+
+	if gb.mixer == nil {
+		gb.mixer = newMixer()
+	}
+	gb.mixer.volume = vol
+}
+
+// SetSampleRate sets the rate, in Hz, at which AudioSamples are produced. It
+// can be changed while running, to keep the host audio queue from drifting.
+func (gb *GameBoy) SetSampleRate(rate int) {
+	if gb == nil || rate <= 0 {
+		return
+	}
+
+	if gb.mixer == nil {
+		gb.mixer = newMixer()
+	}
+	gb.mixer.setRate(rate)
+}
+
+// AudioSamples returns the interleaved stereo (left, right) 16 bit PCM samples
+// produced since the last call. The returned slice is only valid until the
+// next call.
+func (gb *GameBoy) AudioSamples() []int16 {
+	if gb == nil || gb.mixer == nil {
+		return nil
+	}
+
+	return gb.mixer.flush()
+}
 
 func (gb *GameBoy) Press(btns Button, pressed bool) {
 	if gb == nil {
@@ -231,11 +299,18 @@ func (gb *GameBoy) clockCompensate() {
 	gb.interruptCtrl.clock(gb)
 	gb.dmaCtrl.clock(gb)
 	gb.apu.clock(gb)
+	gb.apu.clock(gb)
+	gb.apu.clock(gb)
+	gb.apu.clock(gb)
+	gb.mixer.clock(gb)
 	gb.ppu.clock(gb)
 	gb.ppu.clock(gb)
 	gb.ppu.clock(gb)
 	gb.ppu.clock(gb)
 	gb.serial.clock(gb)
+	if gb.cartridge != nil {
+		gb.cartridge.clock(gb)
+	}
 	gb.machineCycles++
 }
 
@@ -307,6 +382,17 @@ func (gb *GameBoy) DumpWram() error {
 	return nil
 }
 
+// vramBusy reports whether the cpu is locked out of vram.
+func (gb *GameBoy) vramBusy(write bool) bool {
+	return !gb.UnrestrictedAccess && gb.ppu.vramBusy(write)
+}
+
+// oamBusy reports whether the cpu is locked out of oam, by the ppu or by the
+// oam dma.
+func (gb *GameBoy) oamBusy(write bool) bool {
+	return !gb.UnrestrictedAccess && (gb.ppu.oamBusy(write) || gb.dmaCtrl.active)
+}
+
 func (gb *GameBoy) read(addr uint16) uint8 {
 	if gb == nil {
 		return 0
@@ -333,6 +419,9 @@ func (gb *GameBoy) read(addr uint16) uint8 {
 
 	// vram
 	if addr >= 0x8000 && addr <= 0x9FFF {
+		if gb.vramBusy(false) {
+			return 0xFF
+		}
 		return gb.ppu.read(addr)
 	}
 
@@ -348,6 +437,9 @@ func (gb *GameBoy) read(addr uint16) uint8 {
 
 	// oam
 	if addr >= 0xFE00 && addr <= 0xFE9F {
+		if gb.oamBusy(false) {
+			return 0xFF
+		}
 		return gb.ppu.read(addr)
 	}
 
@@ -418,7 +510,7 @@ func (gb *GameBoy) read(addr uint16) uint8 {
 
 	// dma
 	if addr == 0xFF46 {
-		return gb.ppu.read(addr)
+		return gb.dmaCtrl.read(addr)
 	}
 
 	// palettes
@@ -467,6 +559,9 @@ func (gb *GameBoy) write(addr uint16, v uint8) {
 
 	// vram
 	if addr >= 0x8000 && addr <= 0x9FFF {
+		if gb.vramBusy(true) {
+			return
+		}
 		gb.ppu.write(addr, v)
 		return
 	}
@@ -485,6 +580,9 @@ func (gb *GameBoy) write(addr uint16, v uint8) {
 
 	// oam
 	if addr >= 0xFE00 && addr <= 0xFE9F {
+		if gb.oamBusy(true) {
+			return
+		}
 		gb.ppu.write(addr, v)
 		return
 	}
@@ -520,37 +618,37 @@ func (gb *GameBoy) write(addr uint16, v uint8) {
 
 	// pulse1
 	if addr >= 0xFF10 && addr <= 0xFF14 {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
 	// pulse2
 	if addr >= 0xFF16 && addr <= 0xFF19 {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
 	// wave
 	if addr >= 0xFF1A && addr <= 0xFF1E {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
 	// wave pattern
 	if addr >= 0xFF30 && addr <= 0xFF3F {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
 	// noise
 	if addr >= 0xFF20 && addr <= 0xFF23 {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
 	// apu ctrl
 	if addr >= 0xFF24 && addr <= 0xFF26 {
-		gb.apu.write(addr, v)
+		gb.writeAPU(addr, v)
 		return
 	}
 
@@ -569,7 +667,6 @@ func (gb *GameBoy) write(addr uint16, v uint8) {
 	// dma
 	if addr == 0xFF46 {
 		gb.dmaCtrl.write(addr, v)
-		gb.state |= dma
 		return
 	}
 
@@ -594,6 +691,13 @@ func (gb *GameBoy) write(addr uint16, v uint8) {
 	// panic(fmt.Sprintf("unmapped write at 0%X", addr))
 }
 
+func (gb *GameBoy) writeAPU(addr uint16, v uint8) {
+	if gb.vgm != nil {
+		gb.vgm.write(gb.machineCycles, addr, v)
+	}
+	gb.apu.write(addr, v)
+}
+
 type busDevice interface {
 	clock(gb *GameBoy)
 	read(addr uint16) uint8
@@ -0,0 +1,284 @@
+package gb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	gbsHeaderSize = 0x70
+
+	// the driver lives in the first 0x400 bytes of the image, below the
+	// lowest load address allowed by the format
+	gbsMinLoadAddr = 0x0400
+	gbsEntry       = 0x0100
+	gbsSongOperand = gbsEntry + 5 // operand of the ld a, n that selects the song
+)
+
+// GBSInfo describes a GBS (Game Boy Sound System) rip, as found in its
+// header.
+type GBSInfo struct {
+	Title     string
+	Author    string
+	Copyright string
+
+	Songs     int // Number of songs
+	FirstSong int // Song to play first, 0 based
+
+	LoadAddr     uint16
+	InitAddr     uint16 // Called once with the song number in A
+	PlayAddr     uint16 // Called from VBlank, or from the timer interrupt if TAC enables it
+	StackPointer uint16
+	TimerModulo  uint8 // TMA
+	TimerControl uint8 // TAC
+}
+
+func parseGBSHeader(data []byte) (GBSInfo, error) {
+	var info GBSInfo
+
+	if len(data) < gbsHeaderSize || string(data[0:3]) != "GBS" {
+		return info, errors.New("not a gbs file")
+	}
+
+	if data[0x03] != 1 {
+		return info, fmt.Errorf("unsupported gbs version %d", data[0x03])
+	}
+
+	le16 := func(i int) uint16 { return uint16(data[i+1])<<8 | uint16(data[i]) }
+
+	info.Songs = int(data[0x04])
+	info.FirstSong = int(data[0x05]) - 1
+	info.LoadAddr = le16(0x06)
+	info.InitAddr = le16(0x08)
+	info.PlayAddr = le16(0x0A)
+	info.StackPointer = le16(0x0C)
+	info.TimerModulo = data[0x0E]
+	info.TimerControl = data[0x0F]
+	info.Title = strings.TrimRight(string(data[0x10:0x30]), "\x00")
+	info.Author = strings.TrimRight(string(data[0x30:0x50]), "\x00")
+	info.Copyright = strings.TrimRight(string(data[0x50:0x70]), "\x00")
+
+	if info.Songs == 0 {
+		return info, errors.New("gbs has no songs")
+	}
+	if info.FirstSong < 0 || info.FirstSong >= info.Songs {
+		info.FirstSong = 0
+	}
+	if info.LoadAddr < gbsMinLoadAddr || info.LoadAddr >= 0x8000 {
+		return info, fmt.Errorf("invalid gbs load address 0x%04X", info.LoadAddr)
+	}
+
+	return info, nil
+}
+
+// usesTimer reports whether the play routine is driven by the timer
+// interrupt instead of VBlank.
+func (info GBSInfo) usesTimer() bool {
+	return info.TimerControl&0x04 > 0
+}
+
+// NewGBSCartridge loads a GBS file into a cartridge that plays its first
+// song when the GameBoy is powered on.
+func NewGBSCartridge(r io.Reader) (*Cartridge, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read gbs: %w", err)
+	}
+
+	info, err := parseGBSHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newGBSMapper(info, data[gbsHeaderSize:])
+
+	return &Cartridge{
+		CartridgeInfo: CartridgeInfo{
+			Title:   info.Title,
+			ROMSize: size(len(m.rom)),
+			RAMSize: size(len(m.ram)),
+		},
+		mbc: m,
+	}, nil
+}
+
+// GBSInfo returns the header of the inserted GBS file, if any.
+func (gb *GameBoy) GBSInfo() (GBSInfo, bool) {
+	m := gb.gbs()
+	if m == nil {
+		return GBSInfo{}, false
+	}
+
+	return m.info, true
+}
+
+// Track returns the song being played, 0 based.
+func (gb *GameBoy) Track() int {
+	m := gb.gbs()
+	if m == nil {
+		return 0
+	}
+
+	return m.song()
+}
+
+// SetTrack restarts the console playing song n, wrapping around the number of
+// songs. It does nothing if the cartridge is not a GBS file.
+func (gb *GameBoy) SetTrack(n int) {
+	m := gb.gbs()
+	if m == nil {
+		return
+	}
+
+	m.setSong(n)
+	gb.PowerOn()
+}
+
+// NextTrack plays the next song.
+func (gb *GameBoy) NextTrack() {
+	gb.SetTrack(gb.Track() + 1)
+}
+
+// PrevTrack plays the previous song.
+func (gb *GameBoy) PrevTrack() {
+	gb.SetTrack(gb.Track() - 1)
+}
+
+func (gb *GameBoy) gbs() *gbsMapper {
+	if gb == nil || gb.cartridge == nil {
+		return nil
+	}
+
+	m, _ := gb.cartridge.mbc.(*gbsMapper)
+	return m
+}
+
+// gbsMapper is a stand in for the mapper the music was ripped from. The rom
+// holds a small driver below the load address that calls init once and then
+// play on every interrupt, banks are switched through 0x2000-0x3FFF and 8KiB
+// of ram are always enabled.
+type gbsMapper struct {
+	info GBSInfo
+	rom  rom
+	ram  sram
+	bank uint8
+}
+
+func newGBSMapper(info GBSInfo, data []byte) *gbsMapper {
+	end := int(info.LoadAddr) + len(data)
+	image := make(rom, (end+0x3FFF)/0x4000*0x4000)
+	if len(image) < 0x8000 {
+		image = append(image, make(rom, 0x8000-len(image))...)
+	}
+	copy(image[info.LoadAddr:], data)
+
+	m := &gbsMapper{
+		info: info,
+		rom:  image,
+		ram:  make(sram, 8*KiB),
+		bank: 1,
+	}
+	m.writeDriver()
+	m.setSong(info.FirstSong)
+
+	return m
+}
+
+func (m *gbsMapper) writeDriver() {
+	lo := func(v uint16) uint8 { return uint8(v) }
+	hi := func(v uint16) uint8 { return uint8(v >> 8) }
+
+	// rst vectors jump to the same offset from the load address
+	for i := uint16(0); i < 8; i++ {
+		dst := m.info.LoadAddr + i*8
+		copy(m.rom[i*8:], []uint8{0xC3, lo(dst), hi(dst)}) // jp dst
+	}
+
+	// vblank and timer handlers
+	for _, vector := range []uint16{0x40, 0x50} {
+		copy(m.rom[vector:], []uint8{
+			0xCD, lo(m.info.PlayAddr), hi(m.info.PlayAddr), // call play
+			0xD9, // reti
+		})
+	}
+
+	var ie uint8 = 1 << 0 // vblank
+	if m.info.usesTimer() {
+		ie = 1 << 2 // timer
+	}
+
+	sp, init := m.info.StackPointer, m.info.InitAddr
+	tma, tac := m.info.TimerModulo, m.info.TimerControl&0x07
+	copy(m.rom[gbsEntry:], []uint8{
+		0xF3,                 // di
+		0x31, lo(sp), hi(sp), // ld sp, StackPointer
+		0x3E, 0x00, // ld a, song
+		0xCD, lo(init), hi(init), // call init
+		0x3E, tma, 0xE0, 0x06, // ld a, TMA; ldh (TMA), a
+		0x3E, tac, 0xE0, 0x07, // ld a, TAC; ldh (TAC), a
+		0x3E, ie, 0xE0, 0xFF, // ld a, ie; ldh (IE), a
+		0xAF, 0xE0, 0x0F, // xor a; ldh (IF), a
+		0xFB,       // ei
+		0x76,       // halt
+		0x18, 0xFD, // jr halt
+	})
+}
+
+func (m *gbsMapper) song() int {
+	return int(m.rom[gbsSongOperand])
+}
+
+// setSong selects the song the driver plays and resets the mapper, the
+// console must be powered on again for it to take effect.
+func (m *gbsMapper) setSong(n int) {
+	n %= m.info.Songs
+	if n < 0 {
+		n += m.info.Songs
+	}
+
+	m.rom[gbsSongOperand] = uint8(n)
+	m.bank = 1
+	for i := range m.ram {
+		m.ram[i] = 0
+	}
+}
+
+func (*gbsMapper) clock(gb *GameBoy) {}
+
+func (m *gbsMapper) read(addr uint16) uint8 {
+	if addr >= 0x0000 && addr <= 0x3FFF {
+		return m.rom.read(uint64(addr))
+	}
+
+	if addr >= 0x4000 && addr <= 0x7FFF {
+		return m.rom.read(uint64(m.bank)*0x4000 + uint64(addr-0x4000))
+	}
+
+	if addr >= 0xA000 && addr <= 0xBFFF {
+		return m.ram.read(uint32(addr - 0xA000))
+	}
+
+	return 0xFF
+}
+
+func (m *gbsMapper) write(addr uint16, v uint8) {
+	if addr >= 0x2000 && addr <= 0x3FFF {
+		m.bank = v
+		if m.bank == 0 {
+			m.bank = 1
+		}
+		return
+	}
+
+	if addr >= 0xA000 && addr <= 0xBFFF {
+		m.ram.write(uint32(addr-0xA000), v)
+		return
+	}
+}
+
+func (*gbsMapper) saveable() bool  { return false }
+func (*gbsMapper) save() []byte    { return nil }
+func (*gbsMapper) loadSave([]byte) {}
@@ -0,0 +1,111 @@
+package gb
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testGBS builds a gbs whose init stores the song number at 0xC000 and whose
+// play routine increments 0xC001.
+func testGBS(songs, first, tma, tac uint8) []byte {
+	header := make([]byte, gbsHeaderSize)
+	copy(header, "GBS")
+	header[0x03] = 1
+	header[0x04] = songs
+	header[0x05] = first
+	header[0x06], header[0x07] = 0x00, 0x04 // load
+	header[0x08], header[0x09] = 0x00, 0x04 // init
+	header[0x0A], header[0x0B] = 0x04, 0x04 // play
+	header[0x0C], header[0x0D] = 0xFE, 0xFF // sp
+	header[0x0E] = tma
+	header[0x0F] = tac
+	copy(header[0x10:], "test")
+
+	code := []byte{
+		0xEA, 0x00, 0xC0, // ld (0xC000), a
+		0xC9,             // ret
+		0x21, 0x01, 0xC0, // ld hl, 0xC001
+		0x34, // inc (hl)
+		0xC9, // ret
+	}
+
+	return append(header, code...)
+}
+
+func TestGBS(t *testing.T) {
+	tests := []struct {
+		name     string
+		tma, tac uint8
+		plays    int
+	}{
+		{"vblank", 0x00, 0x00, 60},
+		{"timer", 0x00, 0x04, 16},     // 4096Hz / 256
+		{"timer tma", 0x80, 0x04, 32}, // 4096Hz / 128
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart, err := NewGBSCartridge(bytes.NewReader(testGBS(3, 2, tt.tma, tt.tac)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gb GameBoy
+			if err := gb.InsertCartridge(cart, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			gb.PowerOn()
+
+			info, ok := gb.GBSInfo()
+			if !ok {
+				t.Fatal("GBSInfo reported no gbs")
+			}
+			if info.Title != "test" || info.Songs != 3 || info.FirstSong != 1 {
+				t.Fatalf("got info %+v", info)
+			}
+
+			for _, track := range []int{1, 2, 0, 2} {
+				if got := gb.Track(); got != track {
+					t.Fatalf("got track %d, want %d", got, track)
+				}
+
+				// one second worth of frames
+				for i := 0; i < 60; i++ {
+					gb.ClockFrame()
+				}
+
+				if got := int(gb.read(0xC000)); got != track {
+					t.Errorf("track %d: init got song %d", track, got)
+				}
+				if got := int(gb.read(0xC001)); got < tt.plays-1 || got > tt.plays+1 {
+					t.Errorf("track %d: play was called %d times, want ~%d", track, got, tt.plays)
+				}
+
+				if track == 0 {
+					gb.PrevTrack()
+				} else {
+					gb.NextTrack()
+				}
+				gb.write(0xC001, 0)
+			}
+		})
+	}
+}
+
+func TestGBSInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"magic", append([]byte("GBX"), testGBS(1, 1, 0, 0)[3:]...)},
+		{"no songs", func() []byte { d := testGBS(1, 1, 0, 0); d[0x04] = 0; return d }()},
+		{"load address", func() []byte { d := testGBS(1, 1, 0, 0); d[0x07] = 0x03; return d }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGBSCartridge(bytes.NewReader(tt.data)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
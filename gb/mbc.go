@@ -1,6 +1,6 @@
 package gb
 
-import "fmt"
+import "bytes"
 
 type sram []uint8
 
@@ -27,6 +27,11 @@ type mbc interface {
 	loadSave(d []byte)
 }
 
+// clockedMbc is implemented by mbcs with a real time clock.
+type clockedMbc interface {
+	setClock(c Clock)
+}
+
 type mbcFlags uint8
 
 const (
@@ -34,6 +39,7 @@ const (
 	mbcRam mbcFlags = 1 << iota
 	mbcBattery
 	mbcTimer
+	mbcRumble
 )
 
 var mbcs = map[uint8]func(rom, CartridgeInfo) mbc{
@@ -48,17 +54,17 @@ var mbcs = map[uint8]func(rom, CartridgeInfo) mbc{
 	// 0x0B: mmm01{},
 	// 0x0C: mmm01{ram: true},
 	// 0x0D: mmm01{ram: true, battery: true},
-	// 0x0F: mbc3{timer: true, battery: true},
-	// 0x10: mbc3{ram: true, timer: true, battery: true},
+	0x0F: newMbc3(mbcTimer | mbcBattery),
+	0x10: newMbc3(mbcRam | mbcTimer | mbcBattery),
 	0x11: newMbc3(none),
 	0x12: newMbc3(mbcRam),
 	0x13: newMbc3(mbcRam | mbcBattery),
-	// 0x19: mbc5{},
-	// 0x1A: mbc5{ram: true},
-	// 0x1B: mbc5{ram: true, battery: true},
-	// 0x1C: mbc5{rumble: true},
-	// 0x1D: mbc5{ram: true, rumble: true},
-	// 0x1E: mbc5{ram: true, battery: true, rumble: true},
+	0x19: newMbc5(none),
+	0x1A: newMbc5(mbcRam),
+	0x1B: newMbc5(mbcRam | mbcBattery),
+	0x1C: newMbc5(mbcRumble),
+	0x1D: newMbc5(mbcRam | mbcRumble),
+	0x1E: newMbc5(mbcRam | mbcBattery | mbcRumble),
 	// 0x20: mbc6{ram: true, battery: true},
 	// 0x22: mbc7{ram: true, battery: true, accelerometer: true},
 	// 0xFC: pocket{camera: true},
@@ -96,6 +102,9 @@ type mbc1 struct {
 	bankMode uint8
 	bankLo   uint8
 	bankHi   uint8
+
+	// multicarts (MBC1M) only wire 4 bits of bankLo, bankHi selects the game
+	hiShift uint
 }
 
 func newMbc1(f mbcFlags) func(rom, CartridgeInfo) mbc {
@@ -104,6 +113,11 @@ func newMbc1(f mbcFlags) func(rom, CartridgeInfo) mbc {
 			rom:     rom,
 			bankLo:  1,
 			battery: f&mbcBattery > 0,
+			hiShift: 5,
+		}
+
+		if isMbc1Multicart(rom) {
+			v.hiShift = 4
 		}
 
 		if f&mbcRam > 0 {
@@ -114,19 +128,46 @@ func newMbc1(f mbcFlags) func(rom, CartridgeInfo) mbc {
 	}
 }
 
+// nintendoLogo is the logo every header carries at 0x104.
+var nintendoLogo = [...]uint8{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+// isMbc1Multicart guesses whether rom is a MBC1M multicart, nothing in the
+// header tells them apart. They are 8Mbit roms made of 2Mbit games, each with
+// its own header, so look for more than one logo at 256KiB boundaries.
+func isMbc1Multicart(rom rom) bool {
+	if size(len(rom)) != 1*MiB {
+		return false
+	}
+
+	var games int
+	for off := 0; off < len(rom); off += int(256 * KiB) {
+		logo := rom[off+0x104 : off+0x104+len(nintendoLogo)]
+		if bytes.Equal(logo, nintendoLogo[:]) {
+			games++
+		}
+	}
+
+	return games > 1
+}
+
 func (*mbc1) clock(gb *GameBoy) {}
 
 func (m *mbc1) read(addr uint16) uint8 {
 	if addr >= 0x0000 && addr <= 0x3FFF {
 		var bank uint64
 		if m.bankMode == 1 {
-			bank = uint64(m.bankHi << 5)
+			bank = uint64(m.bankHi) << m.hiShift
 		}
 		return m.rom.read(bank*0x4000 + uint64(addr))
 	}
 
 	if addr >= 0x4000 && addr <= 0x7FFF {
-		bank := uint64(m.bankHi<<5 | m.bankLo)
+		lo := uint64(m.bankLo) & (1<<m.hiShift - 1)
+		bank := uint64(m.bankHi)<<m.hiShift | lo
 		return m.rom.read(bank*0x4000 + uint64(addr-0x4000))
 	}
 
@@ -199,7 +240,7 @@ func (m *mbc1) loadSave(d []byte) {
 
 type mbc2 struct {
 	rom        rom
-	ram        sram
+	ram        sram // 512x4 bits, echoed across 0xA000-0xBFFF
 	romBank    uint64
 	ramEnabled bool
 	battery    bool
@@ -229,6 +270,7 @@ func (m *mbc2) read(addr uint16) uint8 {
 	}
 
 	if m.ramEnabled && addr >= 0xA000 && addr <= 0xBFFF {
+		// only the low nibble exists, the rest of the bus reads high
 		return m.ram.read(uint32(addr-0xA000)) | 0xF0
 	}
 
@@ -237,6 +279,7 @@ func (m *mbc2) read(addr uint16) uint8 {
 
 func (m *mbc2) write(addr uint16, v uint8) {
 	if addr >= 0x0000 && addr <= 0x3FFF {
+		// bit 8 of the address selects the register
 		if addr&0x0100 == 0 {
 			m.ramEnabled = v&0x0F == 0x0A
 			return
@@ -265,6 +308,7 @@ func (m *mbc2) loadSave(d []byte) {
 type mbc3 struct {
 	rom     rom
 	ram     sram
+	rtc     *rtc
 	battery bool
 
 	ramRTC bool
@@ -272,17 +316,7 @@ type mbc3 struct {
 	romBank    uint8
 	ramRtcBank uint8
 
-	RTCS  uint8 // 08h Seconds   0-59 (0-3Bh)
-	RTCM  uint8 // 09h Minutes   0-59 (0-3Bh)
-	RTCH  uint8 // 0Ah Hours     0-23 (0-17h)
-	RTCDL uint8 // 0Bh Lower 8 bits of Day Counter (0-FFh)
-	RTCDH uint8 // 0Ch Upper 1 bit of Day Counter, Carry Bit, Halt Flag
-	//                 Bit 0  Most significant bit of Day Counter (Bit 8)
-	//                 Bit 6  Halt (0=Active, 1=Stop Timer)
-	//                 Bit 7  Day Counter Carry Bit (1=Counter Overflow)
-
 	prevRtcWrite uint8
-	clocks       uint64
 }
 
 func newMbc3(f mbcFlags) func(rom, CartridgeInfo) mbc {
@@ -297,15 +331,24 @@ func newMbc3(f mbcFlags) func(rom, CartridgeInfo) mbc {
 			v.ram = make(sram, c.RAMSize)
 		}
 
+		if f&mbcTimer > 0 {
+			v.rtc = &rtc{}
+		}
+
 		return v
 	}
 }
 
+func (m *mbc3) setClock(c Clock) {
+	if m.rtc != nil {
+		m.rtc.wallClock = c
+	}
+}
+
 func (m *mbc3) clock(gb *GameBoy) {
-	if m.clocks%128 == 0 {
-		// rtc
+	if m.rtc != nil {
+		m.rtc.clock()
 	}
-	m.clocks++
 }
 
 func (m *mbc3) read(addr uint16) uint8 {
@@ -322,19 +365,21 @@ func (m *mbc3) read(addr uint16) uint8 {
 
 	// RAM Bank/RTC Register
 	if addr >= 0xA000 && addr <= 0xBFFF {
-		if m.ramRtcBank >= 0x00 && m.ramRtcBank <= 0x07 {
+		if !m.ramRTC {
+			return 0xFF
+		}
+
+		if m.ramRtcBank <= 0x07 {
 			bank := uint32(m.ramRtcBank)
-			// return m.ram[(bank+int(addr-0xA000))%len(m.ram)]
 			return m.ram.read(bank*0x2000 + uint32(addr-0xA000))
-		} else {
-			// rtc
 		}
 
-		return 0xff
+		if m.rtc != nil && m.ramRtcBank >= rtcS && m.ramRtcBank <= rtcDH {
+			return m.rtc.read(m.ramRtcBank)
+		}
 	}
 
-	panic(fmt.Sprintf("hm? %04x", addr))
-	return 0xff
+	return 0xFF
 }
 
 func (m *mbc3) write(addr uint16, v uint8) {
@@ -363,8 +408,8 @@ func (m *mbc3) write(addr uint16, v uint8) {
 
 	// Latch Clock Data
 	if addr >= 0x6000 && addr <= 0x7FFF {
-		if v == 1 && m.prevRtcWrite == 0 {
-			m.latch()
+		if v == 1 && m.prevRtcWrite == 0 && m.rtc != nil {
+			m.rtc.latch()
 		}
 
 		m.prevRtcWrite = v
@@ -373,24 +418,152 @@ func (m *mbc3) write(addr uint16, v uint8) {
 
 	// RAM Bank/RTC Register
 	if addr >= 0xA000 && addr <= 0xBFFF {
-		if m.ramRtcBank >= 0x00 && m.ramRtcBank <= 0x07 {
+		if !m.ramRTC {
+			return
+		}
+
+		if m.ramRtcBank <= 0x07 {
 			bank := uint32(m.ramRtcBank)
 			m.ram.write(bank*0x2000+uint32(addr-0xA000), v)
 			return
-		} else {
-			// rtc
 		}
 
-		return
+		if m.rtc != nil && m.ramRtcBank >= rtcS && m.ramRtcBank <= rtcDH {
+			m.rtc.write(m.ramRtcBank, v)
+		}
 	}
-
-	panic(fmt.Sprintf("hm? %04x %02x", addr, v))
 }
 
 func (m *mbc3) saveable() bool { return m.battery }
-func (m *mbc3) save() []byte   { return m.ram[:] }
+
+// save appends the rtc state after the ram, in the 48 byte footer most
+// emulators agree on.
+func (m *mbc3) save() []byte {
+	if m.rtc == nil {
+		return m.ram[:]
+	}
+
+	ret := make([]byte, 0, len(m.ram)+rtcFooterSize)
+	ret = append(ret, m.ram...)
+	return append(ret, m.rtc.save()...)
+}
+
 func (m *mbc3) loadSave(d []byte) {
 	copy(m.ram[:], d)
+
+	if m.rtc != nil && len(d) >= len(m.ram)+rtcFooterMinSize {
+		m.rtc.loadSave(d[len(m.ram):])
+	}
 }
 
-func (m *mbc3) latch() {}
+type mbc5 struct {
+	rom        rom
+	ram        sram
+	battery    bool
+	rumble     bool
+	ramEnabled bool
+
+	romBank uint16 // 9 bits, bank 0 can be selected
+	ramBank uint8
+
+	motor         bool
+	reportedMotor bool
+}
+
+func newMbc5(f mbcFlags) func(rom, CartridgeInfo) mbc {
+	return func(rom rom, c CartridgeInfo) mbc {
+		v := &mbc5{
+			rom:     rom,
+			romBank: 1,
+			battery: f&mbcBattery > 0,
+			rumble:  f&mbcRumble > 0,
+		}
+
+		if f&mbcRam > 0 {
+			v.ram = make(sram, c.RAMSize)
+		}
+
+		return v
+	}
+}
+
+// clock reports changes of the rumble motor, the mbc has no way to reach the
+// GameBoy when it's written to.
+func (m *mbc5) clock(gb *GameBoy) {
+	if m.motor == m.reportedMotor {
+		return
+	}
+
+	m.reportedMotor = m.motor
+	if gb.Rumble != nil {
+		gb.Rumble(m.motor)
+	}
+}
+
+func (m *mbc5) read(addr uint16) uint8 {
+	if addr >= 0x0000 && addr <= 0x3FFF {
+		return m.rom.read(uint64(addr))
+	}
+
+	if addr >= 0x4000 && addr <= 0x7FFF {
+		bank := uint64(m.romBank)
+		return m.rom.read(bank*0x4000 + uint64(addr-0x4000))
+	}
+
+	if addr >= 0xA000 && addr <= 0xBFFF {
+		if !m.ramEnabled {
+			return 0xFF
+		}
+
+		bank := uint32(m.ramBank)
+		return m.ram.read(bank*0x2000 + uint32(addr-0xA000))
+	}
+
+	return 0xFF
+}
+
+func (m *mbc5) write(addr uint16, v uint8) {
+	if addr >= 0x0000 && addr <= 0x1FFF {
+		// unlike the other mbcs, only 0x0A enables ram
+		m.ramEnabled = v == 0x0A
+		return
+	}
+
+	if addr >= 0x2000 && addr <= 0x2FFF {
+		m.romBank = m.romBank&0x100 | uint16(v)
+		return
+	}
+
+	if addr >= 0x3000 && addr <= 0x3FFF {
+		m.romBank = m.romBank&0xFF | uint16(v&0x01)<<8
+		return
+	}
+
+	if addr >= 0x4000 && addr <= 0x5FFF {
+		v &= 0x0F
+		if m.rumble {
+			// bit 3 drives the motor instead of selecting a bank
+			m.motor = v&0x08 > 0
+			v &= 0x07
+		}
+
+		m.ramBank = v
+		return
+	}
+
+	if addr >= 0xA000 && addr <= 0xBFFF {
+		if !m.ramEnabled {
+			return
+		}
+
+		bank := uint32(m.ramBank)
+		m.ram.write(bank*0x2000+uint32(addr-0xA000), v)
+		return
+	}
+}
+
+func (m *mbc5) saveable() bool { return m.battery }
+func (m *mbc5) save() []byte   { return m.ram[:] }
+func (m *mbc5) loadSave(d []byte) {
+	copy(m.ram[:], d)
+}
@@ -0,0 +1,211 @@
+package gb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMbc5Rumble(t *testing.T) {
+	rom := make(rom, 0x8000)
+	copy(rom[0x100:], []uint8{
+		0x3E, 0x0A, // ld a, 0x0A
+		0xEA, 0x00, 0x40, // ld (0x4000), a
+		0x3E, 0x02, // ld a, 0x02
+		0xEA, 0x00, 0x40, // ld (0x4000), a
+		0x18, 0xFE, // jr -2
+	})
+	m := newMbc5(mbcRam|mbcRumble)(rom, CartridgeInfo{RAMSize: 32 * KiB})
+
+	var gb GameBoy
+	if err := gb.InsertCartridge(&Cartridge{mbc: m}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gb.PowerOn()
+
+	var got []bool
+	gb.Rumble = func(on bool) { got = append(got, on) }
+	for i := 0; i < 10; i++ {
+		gb.ExecuteInst()
+	}
+
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("got rumble %v, want [true false]", got)
+	}
+	if bank := m.(*mbc5).ramBank; bank != 2 {
+		t.Errorf("got ram bank %d, want 2", bank)
+	}
+}
+
+func TestMbc5Banking(t *testing.T) {
+	rom := make(rom, 512*0x4000)
+	for bank := 0; bank < 512; bank++ {
+		rom[bank*0x4000] = uint8(bank)
+		rom[bank*0x4000+1] = uint8(bank >> 8)
+	}
+	m := newMbc5(mbcRam)(rom, CartridgeInfo{RAMSize: 128 * KiB})
+
+	romBank := func() int {
+		return int(m.read(0x4000)) | int(m.read(0x4001))<<8
+	}
+
+	m.write(0x2000, 0x00)
+	if got := romBank(); got != 0 {
+		t.Errorf("got rom bank %d, want 0", got)
+	}
+	m.write(0x3000, 0x01)
+	if got := romBank(); got != 0x100 {
+		t.Errorf("got rom bank %d, want 256", got)
+	}
+	m.write(0x2000, 0xFF)
+	if got := romBank(); got != 0x1FF {
+		t.Errorf("got rom bank %d, want 511", got)
+	}
+
+	m.write(0x0000, 0x0A)
+	for bank := uint8(0); bank < 16; bank++ {
+		m.write(0x4000, bank)
+		m.write(0xA000, bank+1)
+	}
+	for bank := uint8(0); bank < 16; bank++ {
+		m.write(0x4000, bank)
+		if got := m.read(0xA000); got != bank+1 {
+			t.Errorf("ram bank %d: got 0x%02X, want 0x%02X", bank, got, bank+1)
+		}
+	}
+
+	m.write(0x0000, 0x00)
+	if got := m.read(0xA000); got != 0xFF {
+		t.Errorf("got 0x%02X with ram disabled, want 0xFF", got)
+	}
+}
+
+func TestMbc3RTC(t *testing.T) {
+	m := newMbc3(mbcRam|mbcTimer|mbcBattery)(make(rom, 0x8000), CartridgeInfo{RAMSize: 8 * KiB})
+
+	setRTC := func(reg, v uint8) {
+		m.write(0x4000, reg)
+		m.write(0xA000, v)
+	}
+	readRTC := func(reg uint8) uint8 {
+		m.write(0x4000, reg)
+		return m.read(0xA000)
+	}
+	latch := func() {
+		m.write(0x6000, 0x00)
+		m.write(0x6000, 0x01)
+	}
+
+	m.write(0x0000, 0x0A)
+	setRTC(rtcS, 59)
+	setRTC(rtcM, 59)
+	setRTC(rtcH, 23)
+	setRTC(rtcDL, 0xFF)
+	setRTC(rtcDH, rtcDayHi)
+
+	for i := 0; i < machineFreq-1; i++ {
+		m.clock(nil)
+	}
+	latch()
+	if got := readRTC(rtcS); got != 59 {
+		t.Errorf("got %d seconds before a second went by, want 59", got)
+	}
+
+	m.clock(nil)
+	if got := readRTC(rtcS); got != 59 {
+		t.Errorf("got %d seconds without latching, want 59", got)
+	}
+
+	latch()
+	want := []struct {
+		reg, v uint8
+	}{
+		{rtcS, 0},
+		{rtcM, 0},
+		{rtcH, 0},
+		{rtcDL, 0},
+		{rtcDH, rtcCarry},
+	}
+	for _, w := range want {
+		if got := readRTC(w.reg); got != w.v {
+			t.Errorf("reg 0x%02X: got 0x%02X, want 0x%02X", w.reg, got, w.v)
+		}
+	}
+
+	// halted clocks don't tick
+	setRTC(rtcDH, rtcHalt)
+	for i := 0; i < 2*machineFreq; i++ {
+		m.clock(nil)
+	}
+	latch()
+	if got := readRTC(rtcS); got != 0 {
+		t.Errorf("got %d seconds while halted, want 0", got)
+	}
+}
+
+type fixedClock time.Time
+
+func (c *fixedClock) Now() time.Time { return time.Time(*c) }
+
+func TestMbc3RTCSave(t *testing.T) {
+	newCart := func(clk Clock) mbc {
+		m := newMbc3(mbcRam|mbcTimer|mbcBattery)(make(rom, 0x8000), CartridgeInfo{RAMSize: 8 * KiB})
+		m.(clockedMbc).setClock(clk)
+		return m
+	}
+
+	clk := fixedClock(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := newCart(&clk)
+	m.write(0x0000, 0x0A)
+	m.write(0xA000, 0x42)
+	m.write(0x4000, rtcM)
+	m.write(0xA000, 10)
+
+	d := m.save()
+	if got, want := len(d), 8*KiB+rtcFooterSize; got != int(want) {
+		t.Fatalf("got %d bytes, want %d", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		clk     Clock
+		h, m, s uint8
+	}{
+		{"catch up", &clk, 1, 11, 1},
+		{"emulated time", EmulatedTime, 0, 10, 0},
+	}
+	clk = fixedClock(time.Time(clk).Add(time.Hour + time.Minute + time.Second))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCart(tt.clk)
+			m.loadSave(d)
+			m.write(0x0000, 0x0A)
+
+			if got := m.read(0xA000); got != 0x42 {
+				t.Errorf("got ram 0x%02X, want 0x42", got)
+			}
+
+			live := m.(*mbc3).rtc.live
+			if live.H != tt.h || live.M != tt.m || live.S != tt.s {
+				t.Errorf("got %02d:%02d:%02d, want %02d:%02d:%02d", live.H, live.M, live.S, tt.h, tt.m, tt.s)
+			}
+		})
+	}
+
+	// saves made without a wall clock don't make the clock jump later on
+	d = newCart(EmulatedTime).save()
+	m = newCart(&clk)
+	m.loadSave(d)
+	if live := m.(*mbc3).rtc.live; live != (rtcRegs{}) {
+		t.Errorf("got %+v after loading an emulated time save, want a zero clock", live)
+	}
+
+	// the epoch is a time like any other
+	clk = fixedClock(time.Unix(-60, 0))
+	d = newCart(&clk).save()
+	clk = fixedClock(time.Unix(0, 0))
+	m = newCart(&clk)
+	m.loadSave(d)
+	if live := m.(*mbc3).rtc.live; live.M != 1 {
+		t.Errorf("got %+v after a minute closed at the epoch, want 1 minute", live)
+	}
+}
@@ -0,0 +1,126 @@
+package gb
+
+import "math"
+
+// DefaultSampleRate is the host sample rate used unless changed with
+// SetSampleRate.
+const DefaultSampleRate = 48000
+
+type mixer struct {
+	volume float64
+	res    resampler
+	rec    *recorder
+	scope  scope
+
+	buf, out []int16
+}
+
+func newMixer() *mixer {
+	return &mixer{
+		volume: 1,
+		res:    newResampler(2, DefaultSampleRate),
+	}
+}
+
+func (m *mixer) setRate(rate int) {
+	m.res.setRate(rate)
+}
+
+func (m *mixer) clock(gb *GameBoy) {
+	channels := gb.apu.channels()
+	l, r := gb.apu.mix(channels)
+	m.scope.push(channels)
+
+	if m.rec != nil {
+		m.rec.push(l, r, channels)
+	}
+
+	in := [2]float64{l, r}
+	if !m.res.push(in[:]) {
+		return
+	}
+
+	// don't grow unbounded if nobody is consuming samples, keep at most one
+	// second worth of audio
+	if len(m.buf) >= m.res.rate*2 {
+		return
+	}
+
+	m.buf = append(m.buf, pcm(m.res.out[0]*m.volume), pcm(m.res.out[1]*m.volume))
+}
+
+// flush returns the buffered samples, the returned slice is only valid until
+// the next call.
+func (m *mixer) flush() []int16 {
+	ret := m.buf
+	m.buf = m.out[:0]
+	m.out = ret
+	return ret
+}
+
+// resampler converts signals sampled at every machine cycle to rate, every
+// output sample is the average of the machine cycles that elapsed since the
+// previous one. The output also goes through a high pass filter, to remove
+// the dc offset of the dacs.
+type resampler struct {
+	rate    int
+	step    float64
+	elapsed float64
+	charge  float64
+
+	count      int
+	sum        []float64
+	capacitors []float64
+	out        []float64
+}
+
+func newResampler(channels, rate int) resampler {
+	r := resampler{
+		sum:        make([]float64, channels),
+		capacitors: make([]float64, channels),
+		out:        make([]float64, channels),
+	}
+	r.setRate(rate)
+	return r
+}
+
+func (r *resampler) setRate(rate int) {
+	r.rate = rate
+	r.step = float64(machineFreq) / float64(rate)
+	r.charge = math.Pow(0.999958, float64(cpuFreq)/float64(rate))
+}
+
+// push adds a sample of every channel, it returns true when a new output
+// sample is available in out.
+func (r *resampler) push(in []float64) bool {
+	for i, v := range in {
+		r.sum[i] += v
+	}
+	r.count++
+
+	r.elapsed++
+	if r.elapsed < r.step {
+		return false
+	}
+	r.elapsed -= r.step
+
+	for i := range r.sum {
+		v := r.sum[i] / float64(r.count)
+		r.out[i] = v - r.capacitors[i]
+		r.capacitors[i] = v - r.out[i]*r.charge
+		r.sum[i] = 0
+	}
+	r.count = 0
+
+	return true
+}
+
+func pcm(v float64) int16 {
+	if v > 1 {
+		v = 1
+	}
+	if v < -1 {
+		v = -1
+	}
+	return int16(v * math.MaxInt16)
+}
@@ -0,0 +1,95 @@
+package gb
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudioSamples(t *testing.T) {
+	f, err := os.Open(filepath.Join("../testdata", "flappyboy.gb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cart, err := NewCartridge(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gb GameBoy
+	if err := gb.InsertCartridge(cart, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gb.SetSampleRate(44100)
+	gb.PowerOn()
+
+	var samples int
+	start := gb.machineCycles
+	for i := 0; i < 60; i++ {
+		gb.ClockFrame()
+		samples += len(gb.AudioSamples())
+	}
+
+	elapsed := float64(gb.machineCycles-start) / machineFreq
+	want := int(elapsed*44100) * 2
+	if diff := samples - want; diff < -4 || diff > 4 {
+		t.Errorf("got %d samples, want ~%d", samples, want)
+	}
+}
+
+func TestMixRouting(t *testing.T) {
+	in := [4]float64{0.1, 0.2, 0.4, 0.8}
+
+	tests := []struct {
+		name        string
+		nr50, nr51  uint8
+		left, right float64
+	}{
+		{"pulse1 left only", 0x77, 0x10, 0.1 / 4, 0},
+		{"noise right only", 0x77, 0x08, 0, 0.8 / 4},
+		{"split", 0x77, 0x21, 0.2 / 4, 0.1 / 4},
+		{"nothing routed", 0x77, 0x00, 0, 0},
+		{"left at half volume", 0x37, 0x11, 0.1 / 4 / 2, 0.1 / 4},
+		{"right at lowest volume", 0x70, 0x11, 0.1 / 4, 0.1 / 4 / 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gb GameBoy
+			gb.PowerOn()
+			gb.write(ioRegs.NR50, tt.nr50)
+			gb.write(ioRegs.NR51, tt.nr51)
+
+			l, r := gb.apu.mix(in)
+			if math.Abs(l-tt.left) > 1e-9 || math.Abs(r-tt.right) > 1e-9 {
+				t.Errorf("got %v, %v, want %v, %v", l, r, tt.left, tt.right)
+			}
+		})
+	}
+}
+
+func TestHighPass(t *testing.T) {
+	res := newResampler(1, DefaultSampleRate)
+
+	// a constant dac output is a dc offset, it must fade out
+	var out []float64
+	for i := 0; i < machineFreq; i++ {
+		if res.push([]float64{1}) {
+			out = append(out, res.out[0])
+		}
+	}
+
+	if out[0] < 0.99 {
+		t.Errorf("got %v as the first sample, want ~1", out[0])
+	}
+	for i := 1; i < len(out); i++ {
+		if out[i] > out[i-1] {
+			t.Fatalf("sample %d grew from %v to %v", i, out[i-1], out[i])
+		}
+	}
+	if last := out[len(out)-1]; last > 0.01 {
+		t.Errorf("got %v after a second, want ~0", last)
+	}
+}
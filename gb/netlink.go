@@ -0,0 +1,267 @@
+package gb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	netLinkMagic = "GBL1"
+
+	netLinkTransfer = 'T' // the peer clocked a transfer, we answer with a reply
+	netLinkReply    = 'R'
+
+	// the peer gave up waiting for our reply, we confirm it unless the reply
+	// is already on its way, so both ends agree on whether it happened
+	netLinkCancel    = 'C'
+	netLinkCancelled = 'X'
+
+	// how long a transfer from the peer is held waiting for the program to
+	// start listening, in machine cycles of this console. The consoles are not
+	// in lockstep, so the peer may be ahead of us.
+	netLinkListenTimeout = 4 * 17556
+
+	// how long a transfer clocked by this console waits for the peer before
+	// cancelling it, and then for the peer to confirm the cancel before the
+	// link is considered broken
+	netLinkReplyTimeout = time.Second
+)
+
+type netLinkMsg struct {
+	kind, seq, v uint8
+}
+
+// NetLink is a link cable over a network connection. The console must be
+// driven through ClockFrame, which answers the transfers clocked by the
+// other end. Transfers clocked by this console block until the other end
+// replies, so latency stalls the one that drives the clock instead of
+// corrupting the transfer.
+type NetLink struct {
+	gb   *GameBoy
+	conn net.Conn
+
+	requests chan netLinkMsg
+	replies  chan netLinkMsg
+	done     chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu  sync.Mutex
+	err error
+
+	seq          uint8
+	pending      netLinkMsg
+	hasPending   bool
+	pendingSince uint64
+}
+
+// NewNetLink connects gb to the console on the other end of conn, which
+// must also be using a NetLink.
+func NewNetLink(gb *GameBoy, conn net.Conn) (*NetLink, error) {
+	if _, err := io.WriteString(conn, netLinkMagic); err != nil {
+		return nil, fmt.Errorf("gb: link handshake: %w", err)
+	}
+
+	magic := make([]byte, len(netLinkMagic))
+	if _, err := io.ReadFull(conn, magic); err != nil {
+		return nil, fmt.Errorf("gb: link handshake: %w", err)
+	}
+	if string(magic) != netLinkMagic {
+		return nil, errors.New("gb: link handshake: peer is not a gb link")
+	}
+
+	l := &NetLink{
+		gb:       gb,
+		conn:     conn,
+		requests: make(chan netLinkMsg, 16),
+		replies:  make(chan netLinkMsg, 16),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go l.readLoop()
+
+	gb.Connect(l)
+	return l, nil
+}
+
+// Err returns the error that broke the connection, if any.
+func (l *NetLink) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close disconnects the console and closes the connection.
+func (l *NetLink) Close() error {
+	l.gb.Connect(nil)
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.conn.Close()
+}
+
+// ClockFrame runs the console for a frame, answering transfers from the
+// other end between instructions, and returns the frame.
+func (l *NetLink) ClockFrame() []uint8 {
+	start := l.gb.machineCycles
+	for l.gb.machineCycles < start+17556 {
+		l.gb.ExecuteInst()
+		l.serve()
+	}
+
+	return l.gb.ppu.frame[:]
+}
+
+// Transfer implements Link, it sends out to the other end and waits for its
+// byte. If the peer takes too long the transfer is cancelled, but the peer
+// may have answered in the meantime, so it still waits for either the answer
+// or the confirmation that the peer dropped it. A peer that doesn't do either
+// breaks the link.
+func (l *NetLink) Transfer(out uint8) uint8 {
+	// we're driving the clock, so we are not listening for the peer
+	if l.hasPending {
+		l.answer(0xFF)
+	}
+
+	l.seq++
+	if !l.send(netLinkMsg{netLinkTransfer, l.seq, out}) {
+		return 0xFF
+	}
+
+	timeout := time.NewTimer(netLinkReplyTimeout)
+	defer timeout.Stop()
+
+	var cancelTimeout <-chan time.Time
+
+	for {
+		select {
+		case m := <-l.replies:
+			if m.seq != l.seq {
+				// a late answer to a transfer that was already settled
+				continue
+			}
+			if m.kind == netLinkCancelled {
+				return 0xFF
+			}
+			return m.v
+
+		case m := <-l.requests:
+			// both ends are driving the clock, nobody hears the other
+			l.refuse(m)
+
+		case <-timeout.C:
+			if !l.send(netLinkMsg{netLinkCancel, l.seq, 0}) {
+				return 0xFF
+			}
+			t := time.NewTimer(netLinkReplyTimeout)
+			defer t.Stop()
+			cancelTimeout = t.C
+
+		case <-cancelTimeout:
+			l.fail(errors.New("gb: link: peer stopped answering"))
+			return 0xFF
+
+		case <-l.done:
+			return 0xFF
+		}
+	}
+}
+
+// serve answers a transfer from the other end once the program is
+// listening, or with 0xFF if it doesn't in time.
+func (l *NetLink) serve() {
+	if !l.hasPending {
+		select {
+		case m := <-l.requests:
+			if m.kind == netLinkCancel {
+				// the transfer was already answered
+				l.refuse(m)
+				return
+			}
+			l.pending = m
+			l.hasPending = true
+			l.pendingSince = l.gb.machineCycles
+		default:
+			return
+		}
+	}
+
+	if s, ok := l.gb.serial.(*serial); ok && s.listening() {
+		l.answer(l.gb.ExternalTransfer(l.pending.v))
+		return
+	}
+
+	if l.gb.machineCycles-l.pendingSince > netLinkListenTimeout {
+		l.answer(0xFF)
+	}
+}
+
+// refuse answers a request from the peer that can't be served.
+func (l *NetLink) refuse(m netLinkMsg) {
+	if m.kind == netLinkCancel {
+		l.send(netLinkMsg{netLinkCancelled, m.seq, 0})
+		return
+	}
+
+	l.send(netLinkMsg{netLinkReply, m.seq, 0xFF})
+}
+
+func (l *NetLink) answer(v uint8) {
+	l.send(netLinkMsg{netLinkReply, l.pending.seq, v})
+	l.hasPending = false
+}
+
+func (l *NetLink) send(m netLinkMsg) bool {
+	if _, err := l.conn.Write([]byte{m.kind, m.seq, m.v}); err != nil {
+		l.fail(err)
+		return false
+	}
+
+	return true
+}
+
+func (l *NetLink) readLoop() {
+	var buf [3]byte
+	for {
+		if _, err := io.ReadFull(l.conn, buf[:]); err != nil {
+			l.fail(err)
+			return
+		}
+
+		m := netLinkMsg{buf[0], buf[1], buf[2]}
+		var ch chan netLinkMsg
+		switch m.kind {
+		case netLinkTransfer, netLinkCancel:
+			ch = l.requests
+		case netLinkReply, netLinkCancelled:
+			ch = l.replies
+		default:
+			l.fail(fmt.Errorf("gb: link: unknown message 0x%02X", m.kind))
+			return
+		}
+
+		// nobody might be draining the channels anymore
+		select {
+		case ch <- m:
+		case <-l.done:
+			return
+		case <-l.closed:
+			return
+		}
+	}
+}
+
+func (l *NetLink) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return
+	}
+
+	l.err = err
+	close(l.done)
+}
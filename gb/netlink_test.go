@@ -0,0 +1,289 @@
+package gb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// netLinkPair connects a and b through a tcp connection over loopback.
+func netLinkPair(t *testing.T, a, b *GameBoy) (*NetLink, *NetLink) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var host *NetLink
+	var hostErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn, err := ln.Accept()
+		if err != nil {
+			hostErr = err
+			return
+		}
+		host, hostErr = NewNetLink(a, conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, err := NewNetLink(b, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+	if hostErr != nil {
+		t.Fatal(hostErr)
+	}
+
+	return host, join
+}
+
+func TestNetLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		slaveSC    uint8
+		slaveDelay time.Duration
+		gotA, gotB uint8
+	}{
+		{"transfer", 0x80, 0, 0x99, 0x42},
+		{"slave starts late", 0x80, 100 * time.Millisecond, 0x99, 0x42},
+		{"slave not listening", 0x00, 0, 0xFF, 0x99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a GameBoy
+			if err := a.InsertCartridge(serialRom(0x42, 0x81), nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			a.PowerOn()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			// the joining console runs in its own process, see
+			// TestNetLinkJoin
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(os.Args[0], "-test.run=^TestNetLinkJoin$")
+			cmd.Env = append(os.Environ(),
+				"GB_NETLINK_JOIN="+ln.Addr().String(),
+				fmt.Sprintf("GB_NETLINK_SC=%d", tt.slaveSC),
+				"GB_NETLINK_DELAY="+tt.slaveDelay.String(),
+			)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			host, err := NewNetLink(&a, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 10; i++ {
+				host.ClockFrame()
+			}
+			if err := host.Err(); err != nil {
+				t.Errorf("host: %v", err)
+			}
+
+			// hanging up tells the joining console we're done
+			host.Close()
+			if err := cmd.Wait(); err != nil {
+				t.Fatalf("join: %v: %s", err, stderr.Bytes())
+			}
+
+			if got := a.read(0xC000); got != tt.gotA {
+				t.Errorf("master got 0x%02X, want 0x%02X", got, tt.gotA)
+			}
+			var gotB uint8
+			if _, err := fmt.Sscanf(stdout.String(), "%02X", &gotB); err != nil {
+				t.Fatalf("join: %v: %q", err, stdout.Bytes())
+			}
+			if gotB != tt.gotB {
+				t.Errorf("slave got 0x%02X, want 0x%02X", gotB, tt.gotB)
+			}
+		})
+	}
+}
+
+// TestNetLinkJoin is the joining end of TestNetLink, it only runs in the
+// process started by it. It clocks the slave until the host hangs up, and
+// prints what the slave received.
+func TestNetLinkJoin(t *testing.T) {
+	addr := os.Getenv("GB_NETLINK_JOIN")
+	if addr == "" {
+		t.Skip("only runs as the other end of TestNetLink")
+	}
+
+	sc, err := strconv.Atoi(os.Getenv("GB_NETLINK_SC"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	delay, err := time.ParseDuration(os.Getenv("GB_NETLINK_DELAY"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var b GameBoy
+	if err := b.InsertCartridge(serialRom(0x99, uint8(sc)), nil, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	b.PowerOn()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	join, err := NewNetLink(&b, conn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer join.Close()
+
+	time.Sleep(delay)
+
+	// the slave keeps running until the host is done, otherwise it could
+	// finish before the master gets to clock the transfer
+	for i := 0; i < 10 || join.Err() == nil; i++ {
+		if i == 60*60 {
+			fmt.Fprintln(os.Stderr, "the host never hung up")
+			os.Exit(1)
+		}
+		join.ClockFrame()
+	}
+	if err := join.Err(); err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%02X\n", b.read(0xC000))
+	os.Exit(0)
+}
+
+func TestNetLinkDisconnect(t *testing.T) {
+	var a, b GameBoy
+	if err := a.InsertCartridge(serialRom(0x42, 0x81), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	a.PowerOn()
+	b.PowerOn()
+
+	host, join := netLinkPair(t, &a, &b)
+	defer host.Close()
+	join.Close()
+
+	// the transfer must not hang once the peer is gone
+	done := make(chan struct{})
+	go func() {
+		host.ClockFrame()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ClockFrame hung after the peer disconnected")
+	}
+
+	if got := a.read(0xC000); got != 0xFF {
+		t.Errorf("master got 0x%02X, want 0xFF", got)
+	}
+	if host.Err() == nil {
+		t.Error("expected an error after the peer disconnected")
+	}
+}
+
+func TestNetLinkCancel(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  netLinkMsg // what the peer sends once the transfer is cancelled, nothing if zero
+		want    uint8
+		wantErr bool
+	}{
+		{"answered before the cancel", netLinkMsg{netLinkReply, 1, 0x99}, 0x99, false},
+		{"dropped", netLinkMsg{netLinkCancelled, 1, 0}, 0xFF, false},
+		{"frozen peer", netLinkMsg{}, 0xFF, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gb GameBoy
+			gb.PowerOn()
+
+			conn, peer := net.Pipe()
+			defer peer.Close()
+
+			peerErr := make(chan error, 1)
+			go func() {
+				buf := make([]byte, len(netLinkMagic))
+				if _, err := io.ReadFull(peer, buf); err != nil {
+					peerErr <- err
+					return
+				}
+				if _, err := io.WriteString(peer, netLinkMagic); err != nil {
+					peerErr <- err
+					return
+				}
+
+				// sit on the transfer until it's cancelled
+				var msgs [6]byte
+				if _, err := io.ReadFull(peer, msgs[:]); err != nil {
+					peerErr <- err
+					return
+				}
+				want := [6]byte{netLinkTransfer, 1, 0x42, netLinkCancel, 1, 0}
+				if msgs != want {
+					peerErr <- fmt.Errorf("got % X, want % X", msgs, want)
+					return
+				}
+
+				if tt.answer.kind == 0 {
+					peerErr <- nil
+					return
+				}
+				_, err := peer.Write([]byte{tt.answer.kind, tt.answer.seq, tt.answer.v})
+				peerErr <- err
+			}()
+
+			l, err := NewNetLink(&gb, conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			if got := l.Transfer(0x42); got != tt.want {
+				t.Errorf("got 0x%02X, want 0x%02X", got, tt.want)
+			}
+			if err := <-peerErr; err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Err(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
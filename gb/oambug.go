@@ -0,0 +1,66 @@
+package gb
+
+type oamBugKind uint8
+
+const (
+	oamBugWrite   oamBugKind = iota // writes, and 16 bit inc/dec
+	oamBugRead                      // reads
+	oamBugReadInc                   // a read and an inc/dec in the same cycle
+)
+
+// oamRow returns the oam row the ppu is reading in the oam search, -1 if
+// it's not searching. It reads a row of 8 bytes, 2 sprites, every cycle of
+// the 80 dots the search takes.
+func (p *ppu) oamRow() int {
+	if !p.LCDC.displayEnabled() || p.firstLine || p.LY > 143 || p.clocks >= 80 {
+		return -1
+	}
+
+	return int(p.clocks) / 4
+}
+
+func (p *ppu) oamWord(row, word int) uint16 {
+	i := row*8 + word*2
+	return uint16(p.OAM[i]) | uint16(p.OAM[i+1])<<8
+}
+
+func (p *ppu) setOAMWord(row, word int, v uint16) {
+	i := row*8 + word*2
+	p.OAM[i] = uint8(v)
+	p.OAM[i+1] = uint8(v >> 8)
+}
+
+// oamBug corrupts oam when the cpu puts an address in 0xFE00-0xFEFF on the
+// bus while the ppu is searching oam. The row being searched gets a mix of
+// its first word and the previous row, and the rest of the previous row.
+func (p *ppu) oamBug(kind oamBugKind, addr uint16) {
+	if addr < 0xFE00 || addr > 0xFEFF {
+		return
+	}
+
+	row := p.oamRow()
+	if row < 1 || row > 19 {
+		return
+	}
+
+	a, b, c := p.oamWord(row, 0), p.oamWord(row-1, 0), p.oamWord(row-1, 2)
+	switch kind {
+	case oamBugWrite:
+		p.setOAMWord(row, 0, ((a^c)&(b^c))^c)
+
+	case oamBugReadInc:
+		if row >= 4 && row < 19 {
+			a, b, c, d := p.oamWord(row-2, 0), p.oamWord(row-1, 0), p.oamWord(row, 0), p.oamWord(row-1, 2)
+			p.setOAMWord(row-1, 0, (b&(a|c|d))|(a&c&d))
+			copy(p.OAM[row*8:row*8+8], p.OAM[(row-1)*8:])
+			copy(p.OAM[(row-2)*8:(row-2)*8+8], p.OAM[(row-1)*8:])
+		}
+		// followed by a regular read corruption
+		p.oamBug(oamBugRead, addr)
+		return
+
+	case oamBugRead:
+		p.setOAMWord(row, 0, b|(a&c))
+	}
+	copy(p.OAM[row*8+2:row*8+8], p.OAM[(row-1)*8+2:])
+}
@@ -0,0 +1,47 @@
+package gb
+
+import "testing"
+
+func TestOamCorruption(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   oamBugKind
+		addr   uint16
+		clocks uint64
+		row    int
+		want   [8]uint8 // the row afterwards
+	}{
+		{"write", oamBugWrite, 0xFE00, 8, 2, [8]uint8{0x00, 0x01, 0x0A, 0x0B, 0x00, 0x00, 0x0E, 0x0F}},
+		{"read", oamBugRead, 0xFE00, 8, 2, [8]uint8{0x08, 0x09, 0x0A, 0x0B, 0x00, 0x00, 0x0E, 0x0F}},
+		{"row 0", oamBugWrite, 0xFE00, 0, 2, [8]uint8{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}},
+		{"outside oam", oamBugWrite, 0xFF00, 8, 2, [8]uint8{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}},
+		{"after the search", oamBugWrite, 0xFE00, 80, 2, [8]uint8{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}},
+
+		// row 4 is mixed with rows 3 and 5 and copied over both, then row 5
+		// gets a regular read corruption
+		{"read inc", oamBugReadInc, 0xFE00, 20, 5, [8]uint8{0x3C, 0x3D, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27}},
+		{"read inc two rows back", oamBugReadInc, 0xFE00, 20, 3, [8]uint8{0x3C, 0x3D, 0x22, 0x23, 0x24, 0x25, 0x26, 0x27}},
+		{"read inc untouched", oamBugReadInc, 0xFE00, 20, 2, [8]uint8{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}},
+		// rows 1-3 only get the read corruption
+		{"read inc early rows", oamBugReadInc, 0xFE00, 8, 2, [8]uint8{0x08, 0x09, 0x0A, 0x0B, 0x00, 0x00, 0x0E, 0x0F}},
+		{"read inc early rows untouched", oamBugReadInc, 0xFE00, 8, 0, [8]uint8{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ppu{LCDC: lcdcDisplayEnable, clocks: tt.clocks}
+			for i := range p.OAM {
+				p.OAM[i] = uint8(i)
+			}
+			p.OAM[12], p.OAM[13] = 0, 0
+			p.OAM[32], p.OAM[33] = 0xFF, 0xFF
+
+			p.oamBug(tt.kind, tt.addr)
+
+			var got [8]uint8
+			copy(got[:], p.OAM[tt.row*8:])
+			if got != tt.want {
+				t.Errorf("got % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
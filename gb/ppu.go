@@ -130,7 +130,7 @@ func (l *lcdStat) setMode(m ppuMode) {
 }
 
 func (l *lcdStat) write(l2 uint8) {
-	*l = lcdStat(l2) & 0x78
+	*l = *l&0x07 | lcdStat(l2)&0x78
 }
 
 type ppu struct {
@@ -152,9 +152,27 @@ type ppu struct {
 	// Nametable1 [1 * KiB]byte
 	// Nametable2 [1 * KiB]byte
 
-	sprites [10]sprite
-	frame   [160 * 144 * 4]uint8
-	clocks  uint64
+	sprites     [10]sprite
+	spriteCount int
+	frame       [160 * 144 * 4]uint8
+	clocks      uint64
+
+	// pixel transfer, mode 3
+	fetcher        fetcher
+	bgFIFO         bgFIFO
+	spriteFIFO     spriteFIFO
+	lx             uint8  // pixels shifted out in this line, the first 8 are off screen
+	discard        uint8  // pixels of the first tile left to drop, SCX%8
+	stall          int    // dots left in a sprite fetch
+	inWindow       bool   // the window started in this line
+	windowWrap     bool   // the window started at WX=166, it spills into the next line
+	windowLine     uint8  // window row to draw next, only advances on lines showing the window
+	wyMatched      bool   // LY matched WY at the start of a line in this frame
+	firstLine      bool   // first line since the lcd was turned on, it skips mode 2
+	statLine       bool   // stat interrupt line, the interrupt fires when it goes high
+	spritesFetched uint16 // sprites of p.sprites already fetched in this line
+	penaltyTiles   uint64 // bg tiles that already delayed a sprite fetch
+	hblankDelay    uint8  // dots left until the hblank source follows mode 0
 
 	nametables     [512 * 256 * 4]byte
 	vram           [128 * 192 * 4]byte
@@ -164,119 +182,111 @@ type ppu struct {
 	hideWindow     bool
 }
 
+// firstLineStart is the dot the first line after turning on the lcd starts
+// at, which makes it that many dots short.
+const firstLineStart = 4
+
 func (p *ppu) clock(gb *GameBoy) {
 	if !p.LCDC.displayEnabled() {
 		return
 	}
 
+	if p.hblankDelay > 0 {
+		p.hblankDelay--
+	}
+
 	switch {
 	case p.LY >= 0 && p.LY <= 143:
-		// mode 2 (oam search)
-		if p.clocks >= 0 && p.clocks <= 79 {
-			p.STAT.setMode(modeOam)
-			if p.clocks == 0 {
-				if p.STAT.oamIntEnabled() {
-					gb.interruptCtrl.raise(lcdStatInterrupt)
-				}
-				p.oamSearch()
+		// mode 2 (oam search), the first line after turning on the lcd
+		// reports mode 0 instead
+		if p.clocks == 0 || (p.firstLine && p.clocks == firstLineStart) {
+			if !p.firstLine {
+				p.STAT.setMode(modeOam)
 			}
-		}
-
-		// mode 3 (draw)
-		if p.clocks >= 80 && p.clocks <= 251 {
-			if p.clocks >= 80 {
-				p.STAT.setMode(modeTransfer)
-			}
-
-			if p.clocks == 251 {
-				p.drawLine()
-				p.drawSprites()
+			p.oamSearch()
+			if p.LY == p.WY {
+				p.wyMatched = true
 			}
 		}
 
-		// mode 0 (hblank)
-		if p.clocks >= 252 && p.clocks <= 455 {
-			p.STAT.setMode(modeHblank)
-			if p.clocks == 252 && p.STAT.hblIntEnabled() {
-				gb.interruptCtrl.raise(lcdStatInterrupt)
-			}
+		// mode 3 (draw), lasts until every pixel has been shifted out
+		if p.clocks == transferStart {
+			p.STAT.setMode(modeTransfer)
+			p.startTransfer()
+		}
+		if p.clocks >= transferStart && p.STAT&lcdStatMode == lcdStat(modeTransfer) {
+			p.transfer()
 		}
 
 	// mode 1 (vblank)
 	case p.LY >= 144 && p.LY <= 153:
 		p.STAT.setMode(modeVblank)
 		if p.clocks == 0 && p.LY == 144 {
+			p.windowLine = 0
+			p.windowWrap = false
+			p.wyMatched = false
 			p.frames++
 			p.drawNametables()
 			p.drawVram()
 			gb.interruptCtrl.raise(vblankInterrupt)
-			if p.STAT.vblIntEnabled() {
-				gb.interruptCtrl.raise(lcdStatInterrupt)
-			}
 		}
 	}
 
 	p.clocks++
-	p.clocks %= 456
-	if p.clocks == 0 {
+	if p.clocks == 456 {
+		p.clocks = 0
+		p.firstLine = false
 		p.LY++
 		p.LY %= 154
-		p.STAT.updateLy(p.LY, p.LYC)
-		if p.LY == p.LYC && p.STAT.lycIntEnabled() {
-			gb.interruptCtrl.raise(lcdStatInterrupt)
-		}
 	}
+
+	p.updateStat(gb)
 }
 
-func (p *ppu) drawLine() {
-	wy := p.WY
-	wx := p.WX - 7
-	fineY := p.LY
-	for fineX := uint8(0); fineX < 160; fineX++ {
-		var window bool
-		var tileIndex uint8
-		var row uint8
-		var tileLo, tileHi uint8
-
-		if p.LCDC.windowEnabled() && p.LY >= wy && fineX+7 >= wx+7 {
-			window = true
-			row = (p.LY - wy) % 8
-			tileIndex = p.tileIndex(fineX-wx, p.LY-wy, window)
-			addr := p.tileBaseAddr(tileIndex) + uint16(row)*2
-			tileLo = p.read(addr)
-			tileHi = p.read(addr + 1)
-
-			tileHi <<= (fineX - wx) % 8
-			tileLo <<= (fineX - wx) % 8
-		} else {
-			row = (fineY + p.SCY) % 8
-			tileIndex = p.tileIndex(fineX+p.SCX, fineY+p.SCY, window)
-			addr := p.tileBaseAddr(tileIndex) + uint16(row)*2
-			tileLo = p.read(addr)
-			tileHi = p.read(addr + 1)
-
-			tileHi <<= (fineX + p.SCX) % 8
-			tileLo <<= (fineX + p.SCX) % 8
-		}
+// ly returns the value of the LY register. Line 153 only reads as such for
+// its first cycle, it reads as 0 for the rest of it.
+func (p *ppu) ly() uint8 {
+	if p.LY == 153 && p.clocks >= 4 {
+		return 0
+	}
 
-		pixelLo := tileLo & 0x80 >> 7
-		pixelHi := tileHi & 0x80 >> 7
-		paletteIdx := pixelHi<<1 | pixelLo
-		colour := p.paletteLookup(paletteIdx, p.BGP)
+	return p.LY
+}
 
-		if (window && p.hideWindow) || (!window && p.hideBackground) {
-			colour = color.RGBA{}
-		}
-		offset := int(fineY)*160*4 + int(fineX)*4
-		p.frame[offset+0] = colour.R
-		p.frame[offset+1] = colour.G
-		p.frame[offset+2] = colour.B
-		p.frame[offset+3] = colour.A
+// updateStat refreshes the coincidence flag and the stat interrupt line. The
+// line is the OR of every enabled source and the interrupt is only raised
+// when it goes high, so a source can't fire while another one keeps the line
+// up. The start of vblank also counts as mode 2 for the oam source, while
+// the hblank source lags 3 dots behind stat reporting mode 0.
+//
+// The comparison with LYC isn't ready for the first cycle of a line (other
+// than lines 0 and 153), the flag stays clear meanwhile and the hblank source
+// keeps driving the line until it is.
+func (p *ppu) updateStat(gb *GameBoy) {
+	p.STAT.updateLy(p.ly(), p.LYC)
+	lineStart := p.clocks < 4 && p.LY != 0 && p.LY != 153
+	if lineStart {
+		p.STAT &^= lcdStatCoincidenceFlag
 	}
 
-	if p.LCDC&lcdcObjEnable == 0 {
-		return
+	var line bool
+	switch ppuMode(p.STAT & lcdStatMode) {
+	case modeHblank:
+		line = p.STAT.hblIntEnabled() && p.hblankDelay == 0
+	case modeVblank:
+		// clocks has already moved past the first dot of the line
+		line = p.STAT.vblIntEnabled() || (p.LY == 144 && p.clocks == 1 && p.STAT.oamIntEnabled())
+	case modeOam:
+		line = p.STAT.oamIntEnabled() || (lineStart && p.STAT.hblIntEnabled())
+	}
+	if p.STAT&lcdStatCoincidenceFlag > 0 && p.STAT.lycIntEnabled() {
+		line = true
 	}
+
+	if line && !p.statLine {
+		gb.interruptCtrl.raise(lcdStatInterrupt)
+	}
+	p.statLine = line
 }
 
 func (p *ppu) tileIndex(x, y uint8, window bool) uint8 {
@@ -306,18 +316,44 @@ func (p *ppu) spriteTileBaseAddr(tileIdx uint16) uint16 {
 	return uint16(0x8000) + tileIdx
 }
 
+// vramBusy reports whether the ppu is reading vram, the cpu can't access it
+// meanwhile. Reads are cut off a cycle before stat reports mode 3.
+func (p *ppu) vramBusy(write bool) bool {
+	if p.STAT&lcdStatMode == lcdStat(modeTransfer) {
+		return true
+	}
+
+	return !write && p.LCDC.displayEnabled() && !p.firstLine && p.LY <= 143 && p.clocks == transferStart
+}
+
+// oamBusy reports whether the ppu is reading oam, the cpu can't access it
+// meanwhile. Reads are cut off as soon as the line starts, a cycle before
+// stat reports mode 2, while writes still go through on the last cycle of
+// mode 2.
+func (p *ppu) oamBusy(write bool) bool {
+	mode := p.STAT & lcdStatMode
+	if mode == lcdStat(modeOam) && write && p.clocks == transferStart {
+		return false
+	}
+	if mode == lcdStat(modeOam) || mode == lcdStat(modeTransfer) {
+		return true
+	}
+
+	return !write && p.LCDC.displayEnabled() && p.LY <= 143 && p.clocks < 4
+}
+
 func (p *ppu) read(addr uint16) uint8 {
 	switch addr {
 	case 0xFF40:
 		return uint8(p.LCDC)
 	case 0xFF41:
-		return uint8(p.STAT)
+		return uint8(0x80 | p.STAT)
 	case 0xFF42:
 		return p.SCY
 	case 0xFF43:
 		return p.SCX
 	case 0xFF44:
-		return p.LY
+		return p.ly()
 	case 0xFF45:
 		return p.LYC
 	case 0xFF4A:
@@ -346,16 +382,10 @@ func (p *ppu) read(addr uint16) uint8 {
 	// }
 
 	if addr >= 0x8000 && addr <= 0x9FFF {
-		if p.STAT&lcdStatMode == 3 {
-			// return 0xFF
-		}
 		return p.VRAM[addr-0x8000]
 	}
 
 	if addr >= 0xFE00 && addr <= 0xFE9F {
-		if p.STAT&lcdStatMode == 2 || p.STAT&lcdStatMode == 3 {
-			// return 0xFF
-		}
 		return p.OAM[addr-0xFE00]
 	}
 	// fmt.Fprintf(os.Stderr, "unhandled ppu read 0x%04X\n", addr)
@@ -366,9 +396,21 @@ func (p *ppu) read(addr uint16) uint8 {
 func (p *ppu) write(addr uint16, v uint8) {
 	switch addr {
 	case 0xFF40:
+		switch {
+		case p.LCDC.displayEnabled() && !lcdc(v).displayEnabled():
+			// the coincidence flag and the stat line keep their last value
+			// while off
+			p.LY = 0
+			p.clocks = 0
+			p.STAT.setMode(modeHblank)
+			p.windowLine = 0
+			p.windowWrap = false
+			p.wyMatched = false
+		case !p.LCDC.displayEnabled() && lcdc(v).displayEnabled():
+			p.firstLine = true
+			p.clocks = firstLineStart
+		}
 		p.LCDC = lcdc(v)
-		// p.LY = 0
-		// p.clocks = 0
 		return
 	case 0xFF41:
 		p.STAT.write(v)
@@ -400,17 +442,11 @@ func (p *ppu) write(addr uint16, v uint8) {
 	}
 
 	if addr >= 0x8000 && addr <= 0x9FFF {
-		if p.STAT&lcdStatMode == 3 {
-			// return
-		}
 		p.VRAM[addr-0x8000] = v
 		return
 	}
 
 	if addr >= 0xFE00 && addr <= 0xFE9F {
-		if p.STAT&lcdStatMode == 2 || p.STAT&lcdStatMode == 3 {
-			// return
-		}
 		p.OAM[addr-0xFE00] = v
 		return
 	}
@@ -420,82 +456,41 @@ func (p *ppu) write(addr uint16, v uint8) {
 	return
 }
 
-func (p *ppu) drawSprites() {
-	if !p.LCDC.spriteEnabled() {
-		return
+// spriteRow reads the row of the sprite in the current line, flipped if
+// needed so the leftmost pixel is in the top bit.
+func (p *ppu) spriteRow(s sprite) (lo, hi uint8) {
+	height := int(p.LCDC.spriteHeight())
+	tile := s.tile
+	if height == 16 {
+		tile &^= 1
 	}
 
-	for i := 0; i < 40; i++ {
-		var (
-			spriteY     = int(p.OAM[i*4+0]) - 16
-			spriteX     = p.OAM[i*4+1] - 8
-			spriteTile  = p.OAM[i*4+2]
-			spriteFlags = spriteFlags(p.OAM[i*4+3])
-		)
-
-		height := int(p.LCDC.spriteHeight())
-
-		row := int(p.LY) - int(spriteY)
-		if row < 0 || row > height-1 {
-			continue
-		}
-		if spriteFlags&spriteFlipY > 0 {
-			row ^= height - 1
-		}
-		addr := 0x8000 + uint16(spriteTile)*16 + uint16(row)*2
-		tileLo := p.read(addr)
-		tileHi := p.read(addr + 1)
-
-		if spriteFlags&spriteFlipX > 0 {
-			tileLo = bits.Reverse8(tileLo)
-			tileHi = bits.Reverse8(tileHi)
-		}
-
-		for fineX := byte(0); fineX < 8; fineX++ {
-			x := spriteX + fineX
-
-			pixelLo := tileLo & 0x80 >> 7
-			pixelHi := tileHi & 0x80 >> 7
-			paletteIdx := pixelHi<<1 | pixelLo
-
-			tileHi <<= 1
-			tileLo <<= 1
-
-			if x < 0 || x > 159 {
-				continue
-			}
-
-			if paletteIdx == 00 {
-				continue
-			}
-
-			var colour color.RGBA
-			switch {
-			case spriteFlags&spriptePalette == 0:
-				colour = p.paletteLookup(paletteIdx, p.OBP0)
-			case spriteFlags&spriptePalette > 0:
-				colour = p.paletteLookup(paletteIdx, p.OBP1)
-			}
-
-			if p.hideSprites {
-				continue
-			}
+	row := int(p.LY) - (int(s.y) - 16)
+	if s.flags&spriteFlipY > 0 {
+		row ^= height - 1
+	}
+	addr := 0x8000 + uint16(tile)*16 + uint16(row)*2
+	lo = p.read(addr)
+	hi = p.read(addr + 1)
 
-			offset := int(p.LY)*160*4 + int(x)*4
-			p.frame[offset+0] = colour.R
-			p.frame[offset+1] = colour.G
-			p.frame[offset+2] = colour.B
-			p.frame[offset+3] = colour.A
-		}
+	if s.flags&spriteFlipX > 0 {
+		lo = bits.Reverse8(lo)
+		hi = bits.Reverse8(hi)
 	}
+
+	return lo, hi
 }
 
-func (p *ppu) oamSearch() { // TODO
+// oamSearch selects the first 10 sprites in oam that overlap the current
+// line. Sprites count towards the limit even if they are off screen
+// horizontally.
+func (p *ppu) oamSearch() {
 	var idx int
 	y := int(p.LY)
+	height := int(p.LCDC.spriteHeight())
 	for i := 0; i < 40; i++ {
 		screenY := int(p.OAM[i*4+0]) - 16
-		if y-screenY < 0 || y-screenY > 7 {
+		if y-screenY < 0 || y-screenY > height-1 {
 			continue
 		}
 
@@ -511,6 +506,7 @@ func (p *ppu) oamSearch() { // TODO
 			break
 		}
 	}
+	p.spriteCount = idx
 }
 
 func (p *ppu) paletteLookup(id, palette uint8) color.RGBA {
@@ -0,0 +1,264 @@
+package gb
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestSprites(t *testing.T) {
+	type obj struct {
+		y, x, tile uint8
+		flags      spriteFlags
+	}
+	tests := []struct {
+		name   string
+		lcdc   lcdc
+		bgTile uint8
+		objs   []obj
+		x      int
+		want   uint8 // colour index on screen
+	}{
+		{"smaller x wins", 0, 0, []obj{{16, 20, 1, 0}, {16, 16, 2, 0}}, 12, 2},
+		{"oam order breaks ties", 0, 0, []obj{{16, 16, 1, 0}, {16, 16, 2, 0}}, 8, 1},
+		{"10 per line", 0, 0, []obj{
+			{16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0},
+			{16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0}, {16, 0, 1, 0},
+			{16, 16, 2, 0},
+		}, 8, 0},
+		{"8x16 bottom half", lcdcObjSize, 0, []obj{{8, 16, 2, 0}}, 8, 3},
+		{"behind bg colour 1-3", 0, 1, []obj{{16, 16, 2, spritePriority}}, 8, 1},
+		{"behind bg colour 0", 0, 0, []obj{{16, 16, 2, spritePriority}}, 8, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+			p := &ppu{
+				LCDC: lcdcDisplayEnable | lcdcObjEnable | lcdcPriority | lcdcBgWindowSelect | tt.lcdc,
+				BGP:  0xE4,
+				OBP0: 0xE4,
+			}
+			// tile n is filled with colour n
+			for n := 1; n < 4; n++ {
+				for row := 0; row < 8; row++ {
+					if n&1 > 0 {
+						p.VRAM[n*16+row*2] = 0xFF
+					}
+					if n&2 > 0 {
+						p.VRAM[n*16+row*2+1] = 0xFF
+					}
+				}
+			}
+			for i := 0x1800; i < 0x1C00; i++ {
+				p.VRAM[i] = tt.bgTile
+			}
+			for i, o := range tt.objs {
+				copy(p.OAM[i*4:], []uint8{o.y, o.x, o.tile, uint8(o.flags)})
+			}
+
+			for p.clocks <= transferStart || p.STAT&lcdStatMode == lcdStat(modeTransfer) {
+				p.clock(gb)
+			}
+
+			want := basePalette[tt.want]
+			offset := tt.x * 4
+			got := color.RGBA{p.frame[offset], p.frame[offset+1], p.frame[offset+2], p.frame[offset+3]}
+			if got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMidLineWrites(t *testing.T) {
+	tests := []struct {
+		name       string
+		addr       uint16
+		v          uint8
+		before     int   // x of a pixel shifted out before the write
+		after      int   // x of a pixel shifted out after it
+		wantBefore uint8 // shade on screen
+		wantAfter  uint8
+	}{
+		{"scx", 0xFF43, 8, 8, 120, 1, 0},
+		{"bgp", 0xFF47, 0x1B, 8, 64, 1, 3},
+		{"obp0", 0xFF48, 0x1B, 32, 96, 3, 0},
+		{"lcdc", 0xFF40, uint8(lcdcDisplayEnable | lcdcPriority | lcdcBgWindowSelect), 32, 96, 3, 0},
+		{"wx", 0xFF4B, 107, 8, 120, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+			p := &ppu{
+				LCDC: lcdcDisplayEnable | lcdcObjEnable | lcdcPriority | lcdcBgWindowSelect | lcdcWindowEnable | lcdcWindowSelect,
+				BGP:  0xE4,
+				OBP0: 0xE4,
+				WX:   255,
+			}
+			// tile n is filled with colour n, the background cycles through
+			// them every tile and the window is made of tile 2
+			for n := 1; n < 4; n++ {
+				for row := 0; row < 8; row++ {
+					if n&1 > 0 {
+						p.VRAM[n*16+row*2] = 0xFF
+					}
+					if n&2 > 0 {
+						p.VRAM[n*16+row*2+1] = 0xFF
+					}
+				}
+			}
+			for i := 0; i < 32; i++ {
+				p.VRAM[0x1800+i] = uint8(i % 4)
+				p.VRAM[0x1C00+i] = 2
+			}
+			// sprites of colour 3 over background colour 0, on each side of
+			// the write
+			copy(p.OAM[:], []uint8{16, 32 + 8, 3, 0, 16, 96 + 8, 3, 0})
+
+			for p.clocks <= transferStart || p.lx < 64+8 {
+				p.clock(gb)
+			}
+			p.write(tt.addr, tt.v)
+			for p.STAT&lcdStatMode == lcdStat(modeTransfer) {
+				p.clock(gb)
+			}
+
+			for _, px := range []struct {
+				x    int
+				want uint8
+			}{{tt.before, tt.wantBefore}, {tt.after, tt.wantAfter}} {
+				want := basePalette[px.want]
+				offset := px.x * 4
+				got := color.RGBA{p.frame[offset], p.frame[offset+1], p.frame[offset+2], p.frame[offset+3]}
+				if got != want {
+					t.Errorf("x %d: got %v, want %v", px.x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	type line struct {
+		window  bool
+		wx, wy  uint8
+		wantWin bool // pixel 0 shows the window
+	}
+	tests := []struct {
+		name  string
+		lines []line
+		want  uint8 // window line counter at the end
+	}{
+		{"counts rendered lines", []line{
+			{true, 7, 0, true},
+			{false, 7, 0, false},
+			{true, 7, 0, true},
+		}, 2},
+		{"wy latched", []line{
+			{true, 7, 0, true},
+			{true, 7, 50, true},
+		}, 2},
+		{"wy not reached", []line{
+			{true, 7, 5, false},
+			{true, 7, 5, false},
+		}, 0},
+		{"wx clipped", []line{
+			{true, 3, 0, true},
+		}, 1},
+		{"wx past the screen", []line{
+			{true, 167, 0, false},
+		}, 0},
+		{"wx 166 spills", []line{
+			{true, 166, 0, false},
+			{true, 200, 0, true},
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+			p := &ppu{BGP: 0xE4}
+			// the window is filled with tile 1, of colour 1
+			for row := 0; row < 8; row++ {
+				p.VRAM[16+row*2] = 0xFF
+			}
+			for i := 0x1C00; i < 0x2000; i++ {
+				p.VRAM[i] = 1
+			}
+
+			for ly, l := range tt.lines {
+				p.LCDC = lcdcDisplayEnable | lcdcPriority | lcdcBgWindowSelect | lcdcWindowSelect
+				if l.window {
+					p.LCDC |= lcdcWindowEnable
+				}
+				p.WX, p.WY = l.wx, l.wy
+				for i := 0; i < 456; i++ {
+					p.clock(gb)
+				}
+
+				want := basePalette[0]
+				if l.wantWin {
+					want = basePalette[1]
+				}
+				offset := ly * 160 * 4
+				got := color.RGBA{p.frame[offset], p.frame[offset+1], p.frame[offset+2], p.frame[offset+3]}
+				if got != want {
+					t.Errorf("line %d: got %v, want %v", ly, got, want)
+				}
+			}
+
+			if p.windowLine != tt.want {
+				t.Errorf("got window line %d, want %d", p.windowLine, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatBlocking(t *testing.T) {
+	tests := []struct {
+		name string
+		stat lcdStat
+		want int // stat interrupts in the first 2 lines, LYC=1
+	}{
+		{"hblank", lcdStatHBlank, 2},
+		{"oam", lcdStatOAM, 2},
+		{"hblank blocks oam", lcdStatHBlank | lcdStatOAM, 3},
+		{"lyc blocks oam", lcdStatCoincidenceInt | lcdStatOAM, 2},
+		{"lyc and hblank block each other", lcdStatCoincidenceInt | lcdStatHBlank, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+			p := &ppu{LCDC: lcdcDisplayEnable, STAT: tt.stat, LYC: 1}
+
+			var got int
+			for p.LY < 2 {
+				gb.interruptCtrl.IF = 0
+				p.clock(gb)
+				if gb.interruptCtrl.IF&lcdStatInterrupt > 0 {
+					got++
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("got %d interrupts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLine153(t *testing.T) {
+	gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+	p := &ppu{LCDC: lcdcDisplayEnable}
+	for p.LY != 153 {
+		p.clock(gb)
+	}
+
+	if got := p.read(0xFF44); got != 153 {
+		t.Errorf("got LY %d at the start of line 153, want 153", got)
+	}
+	for i := 0; i < 4; i++ {
+		p.clock(gb)
+	}
+	if got := p.read(0xFF44); got != 0 {
+		t.Errorf("got LY %d after the first cycle of line 153, want 0", got)
+	}
+}
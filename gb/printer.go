@@ -0,0 +1,323 @@
+package gb
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	printerCmdInit   = 0x01
+	printerCmdPrint  = 0x02
+	printerCmdData   = 0x04
+	printerCmdStatus = 0x0F
+
+	printerStatusChecksum    = 1 << 0
+	printerStatusBusy        = 1 << 1
+	printerStatusFull        = 1 << 2
+	printerStatusUnprocessed = 1 << 3
+
+	printerAlive = 0x81
+
+	// 20x2 tiles, the most a DATA packet carries
+	printerBandSize = 20 * 2 * 16
+	printerCapacity = 9 * printerBandSize
+	printerWidth    = 160
+
+	// status polls the printer stays busy for after a PRINT
+	printerBusyPolls = 4
+
+	// pixels fed for every unit of margin
+	printerMarginLines = 16
+)
+
+type printerState int
+
+const (
+	printerMagic1 printerState = iota
+	printerMagic2
+	printerCommand
+	printerCompression
+	printerLenLo
+	printerLenHi
+	printerData
+	printerChecksumLo
+	printerChecksumHi
+	printerReplyAlive
+	printerReplyStatus
+)
+
+// Printer is a Game Boy Printer, to be plugged into a GameBoy with Connect.
+// Every printed page is written to Dir as a PNG file, a page ends when the
+// game asks for a margin after the image.
+type Printer struct {
+	Dir string
+
+	state       printerState
+	command     uint8
+	compressed  bool
+	length      uint16
+	packet      []uint8
+	sum, check  uint16
+	status      uint8
+	busy        int
+	buf         []uint8 // decompressed tile data, waiting for a PRINT
+	page        [][printerWidth]uint8
+	pages       int
+	err         error
+	lastWritten string
+}
+
+// NewPrinter returns a printer that writes its pages to dir.
+func NewPrinter(dir string) *Printer {
+	return &Printer{Dir: dir}
+}
+
+// Err returns the last error writing a page, if any.
+func (p *Printer) Err() error {
+	return p.err
+}
+
+// LastPage returns the path of the last page written.
+func (p *Printer) LastPage() string {
+	return p.lastWritten
+}
+
+// Transfer implements Link.
+func (p *Printer) Transfer(out uint8) uint8 {
+	switch p.state {
+	case printerMagic1:
+		if out == 0x88 {
+			p.state = printerMagic2
+		}
+
+	case printerMagic2:
+		switch out {
+		case 0x33:
+			p.state = printerCommand
+		case 0x88:
+		default:
+			p.state = printerMagic1
+		}
+
+	case printerCommand:
+		p.command = out
+		p.sum = uint16(out)
+		p.state = printerCompression
+
+	case printerCompression:
+		p.compressed = out&0x01 > 0
+		p.sum += uint16(out)
+		p.state = printerLenLo
+
+	case printerLenLo:
+		p.length = uint16(out)
+		p.sum += uint16(out)
+		p.state = printerLenHi
+
+	case printerLenHi:
+		p.length |= uint16(out) << 8
+		p.sum += uint16(out)
+		p.packet = p.packet[:0]
+		p.state = printerData
+		if p.length == 0 {
+			p.state = printerChecksumLo
+		}
+
+	case printerData:
+		p.packet = append(p.packet, out)
+		p.sum += uint16(out)
+		if len(p.packet) == int(p.length) {
+			p.state = printerChecksumLo
+		}
+
+	case printerChecksumLo:
+		p.check = uint16(out)
+		p.state = printerChecksumHi
+
+	case printerChecksumHi:
+		p.check |= uint16(out) << 8
+		p.state = printerReplyAlive
+
+	case printerReplyAlive:
+		p.handle()
+		p.state = printerReplyStatus
+		return printerAlive
+
+	case printerReplyStatus:
+		p.state = printerMagic1
+		return p.status
+	}
+
+	return 0x00
+}
+
+// handle runs the command of a complete packet.
+func (p *Printer) handle() {
+	if p.sum != p.check {
+		p.status |= printerStatusChecksum
+		return
+	}
+	p.status &^= printerStatusChecksum
+
+	switch p.command {
+	case printerCmdInit:
+		p.buf = p.buf[:0]
+		p.status = 0
+		p.busy = 0
+
+	case printerCmdData:
+		if len(p.packet) == 0 {
+			// an empty packet ends the data
+			p.status |= printerStatusFull
+			return
+		}
+
+		data := p.packet
+		if p.compressed {
+			data = decompressPrinterData(data)
+		}
+		p.buf = append(p.buf, data...)
+		if len(p.buf) > printerCapacity {
+			p.buf = p.buf[:printerCapacity]
+		}
+		p.status |= printerStatusUnprocessed
+		if len(p.buf) == printerCapacity {
+			p.status |= printerStatusFull
+		}
+
+	case printerCmdPrint:
+		if len(p.packet) < 4 {
+			return
+		}
+		margins, palette := p.packet[1], p.packet[2]
+		p.print(margins>>4, margins&0x0F, palette)
+		p.buf = p.buf[:0]
+		p.status &^= printerStatusUnprocessed | printerStatusFull
+		p.status |= printerStatusBusy
+		p.busy = printerBusyPolls
+
+	case printerCmdStatus:
+		if p.busy > 0 {
+			p.busy--
+			if p.busy == 0 {
+				p.status &^= printerStatusBusy
+			}
+		}
+	}
+}
+
+// decompressPrinterData expands the run length encoding used by DATA
+// packets. A control byte with bit 7 set repeats the next byte (b&0x7F)+2
+// times, otherwise the next b+1 bytes are copied as is.
+func decompressPrinterData(data []uint8) []uint8 {
+	var ret []uint8
+	for i := 0; i < len(data); {
+		ctrl := data[i]
+		i++
+
+		if ctrl&0x80 > 0 {
+			if i >= len(data) {
+				break
+			}
+			for n := int(ctrl&0x7F) + 2; n > 0; n-- {
+				ret = append(ret, data[i])
+			}
+			i++
+			continue
+		}
+
+		n := int(ctrl) + 1
+		if i+n > len(data) {
+			n = len(data) - i
+		}
+		ret = append(ret, data[i:i+n]...)
+		i += n
+	}
+
+	return ret
+}
+
+// print renders the buffered tiles into the current page, which is written
+// out once there's a margin after it.
+func (p *Printer) print(before, after, palette uint8) {
+	for i := 0; i < int(before)*printerMarginLines; i++ {
+		p.page = append(p.page, [printerWidth]uint8{})
+	}
+
+	// palette 0 is treated as the usual 0xE4 by the printer
+	if palette == 0 {
+		palette = 0xE4
+	}
+
+	tileRows := len(p.buf) / (20 * 16)
+	for row := 0; row < tileRows; row++ {
+		for y := 0; y < 8; y++ {
+			var line [printerWidth]uint8
+			for tile := 0; tile < 20; tile++ {
+				offset := (row*20+tile)*16 + y*2
+				lo, hi := p.buf[offset], p.buf[offset+1]
+				for x := 0; x < 8; x++ {
+					bit := uint(7 - x)
+					idx := (hi>>bit&1)<<1 | lo>>bit&1
+					line[tile*8+x] = palette >> (idx * 2) & 0x03
+				}
+			}
+			p.page = append(p.page, line)
+		}
+	}
+
+	if after == 0 {
+		return
+	}
+
+	for i := 0; i < int(after)*printerMarginLines; i++ {
+		p.page = append(p.page, [printerWidth]uint8{})
+	}
+	p.Flush()
+}
+
+var printerShades = [4]color.Gray{{0xFF}, {0xAA}, {0x55}, {0x00}}
+
+// Flush writes the current page, if there's anything on it.
+func (p *Printer) Flush() error {
+	if len(p.page) == 0 {
+		return nil
+	}
+
+	img := image.NewGray(image.Rect(0, 0, printerWidth, len(p.page)))
+	for y, line := range p.page {
+		for x, shade := range line {
+			img.SetGray(x, y, printerShades[shade])
+		}
+	}
+	p.page = p.page[:0]
+
+	p.pages++
+	path := filepath.Join(p.Dir, fmt.Sprintf("print-%s-%03d.png", time.Now().Format("20060102-150405"), p.pages))
+	if err := writePNG(path, img); err != nil {
+		p.err = err
+		return err
+	}
+	p.lastWritten = path
+
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
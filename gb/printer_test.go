@@ -0,0 +1,174 @@
+package gb
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// printerPacket builds a packet, including the checksum and the two bytes
+// the printer replies on.
+func printerPacket(cmd uint8, compressed bool, data []uint8) []uint8 {
+	var comp uint8
+	if compressed {
+		comp = 1
+	}
+
+	body := append([]uint8{cmd, comp, uint8(len(data)), uint8(len(data) >> 8)}, data...)
+	var sum uint16
+	for _, b := range body {
+		sum += uint16(b)
+	}
+
+	ret := append([]uint8{0x88, 0x33}, body...)
+	return append(ret, uint8(sum), uint8(sum>>8), 0x00, 0x00)
+}
+
+// sendPacket sends pkt and returns the alive and status bytes.
+func sendPacket(t *testing.T, p *Printer, pkt []uint8) (alive, status uint8) {
+	t.Helper()
+
+	var replies []uint8
+	for _, b := range pkt {
+		replies = append(replies, p.Transfer(b))
+	}
+
+	for i, r := range replies[:len(replies)-2] {
+		if r != 0 {
+			t.Fatalf("got reply 0x%02X to byte %d, want 0", r, i)
+		}
+	}
+
+	return replies[len(replies)-2], replies[len(replies)-1]
+}
+
+func TestDecompressPrinterData(t *testing.T) {
+	got := decompressPrinterData([]uint8{0x02, 1, 2, 3, 0x81, 0xAA, 0x00, 4})
+	want := []uint8{1, 2, 3, 0xAA, 0xAA, 0xAA, 4}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % X, want % X", got, want)
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "printer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewPrinter(dir)
+
+	// one band: the first tile row is solid color 3, the second color 1
+	band := make([]uint8, printerBandSize)
+	for i := 0; i < 20*16; i++ {
+		band[i] = 0xFF
+	}
+	for i := 20 * 16; i < len(band); i += 2 {
+		band[i] = 0xFF
+	}
+
+	// the same band compressed, runs for the solid row and literals for the
+	// other
+	var compressed []uint8
+	compressed = append(compressed, 0xFE, 0xFF) // 128 times 0xFF
+	compressed = append(compressed, 0xFE, 0xFF)
+	compressed = append(compressed, 0xC0, 0xFF) // 66 times 0xFF
+	for i := 0; i < 160; i++ {
+		compressed = append(compressed, 0x01, 0xFF, 0x00)
+	}
+
+	steps := []struct {
+		name   string
+		pkt    []uint8
+		status uint8
+	}{
+		{"init", printerPacket(printerCmdInit, false, nil), 0x00},
+		{"data", printerPacket(printerCmdData, false, band), printerStatusUnprocessed},
+		{"compressed data", printerPacket(printerCmdData, true, compressed), printerStatusUnprocessed},
+		{"end of data", printerPacket(printerCmdData, false, nil), printerStatusUnprocessed | printerStatusFull},
+		{"status", printerPacket(printerCmdStatus, false, nil), printerStatusUnprocessed | printerStatusFull},
+		{"print", printerPacket(printerCmdPrint, false, []uint8{1, 0x01, 0xE4, 0x40}), printerStatusBusy},
+		{"busy", printerPacket(printerCmdStatus, false, nil), printerStatusBusy},
+	}
+	for _, s := range steps {
+		alive, status := sendPacket(t, p, s.pkt)
+		if alive != printerAlive {
+			t.Errorf("%s: got alive 0x%02X, want 0x%02X", s.name, alive, printerAlive)
+		}
+		if status != s.status {
+			t.Errorf("%s: got status 0x%02X, want 0x%02X", s.name, status, s.status)
+		}
+	}
+
+	for i := 0; i < printerBusyPolls; i++ {
+		_, status := sendPacket(t, p, printerPacket(printerCmdStatus, false, nil))
+		if status&printerStatusBusy == 0 {
+			break
+		}
+		if i == printerBusyPolls-1 {
+			t.Error("printer never stopped being busy")
+		}
+	}
+
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if p.LastPage() == "" {
+		t.Fatal("no page written")
+	}
+
+	f, err := os.Open(p.LastPage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two bands and a margin after them
+	if got, want := img.Bounds().Dy(), 2*16+printerMarginLines; got != want {
+		t.Errorf("got height %d, want %d", got, want)
+	}
+	if got, want := img.Bounds().Dx(), printerWidth; got != want {
+		t.Errorf("got width %d, want %d", got, want)
+	}
+
+	shades := []struct {
+		y    int
+		want uint32
+	}{
+		{0, 0x00},      // color 3, black
+		{8, 0xAA},      // color 1, light gray
+		{16, 0x00},     // second band
+		{24, 0xAA},     // second band
+		{2 * 16, 0xFF}, // margin
+		{2*16 + printerMarginLines - 1, 0xFF},
+	}
+	for _, s := range shades {
+		r, _, _, _ := img.At(80, s.y).RGBA()
+		if got := r >> 8; got != s.want {
+			t.Errorf("line %d: got shade 0x%02X, want 0x%02X", s.y, got, s.want)
+		}
+	}
+}
+
+func TestPrinterChecksum(t *testing.T) {
+	p := NewPrinter("")
+
+	pkt := printerPacket(printerCmdData, false, []uint8{1, 2, 3})
+	pkt[len(pkt)-4]++ // corrupt the checksum
+
+	if _, status := sendPacket(t, p, pkt); status&printerStatusChecksum == 0 {
+		t.Errorf("got status 0x%02X, want the checksum error bit set", status)
+	}
+
+	if _, status := sendPacket(t, p, printerPacket(printerCmdStatus, false, nil)); status != 0 {
+		t.Errorf("got status 0x%02X after a good packet, want 0", status)
+	}
+}
@@ -0,0 +1,218 @@
+package gb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Recording describes where recorded audio is written, every writer is
+// optional. The writers are not closed when the recording stops.
+type Recording struct {
+	Rate int // Sample rate in Hz, defaults to DefaultSampleRate
+
+	Mix    io.WriteSeeker // Stereo mix, as heard through the speakers
+	Pulse1 io.WriteSeeker // Mono stem of channel 1
+	Pulse2 io.WriteSeeker // Mono stem of channel 2
+	Wave   io.WriteSeeker // Mono stem of channel 3
+	Noise  io.WriteSeeker // Mono stem of channel 4
+}
+
+// StartRecording records the audio output to WAV files until StopRecording
+// is called. The recording is independent of the volume and sample rate set
+// for playback.
+func (gb *GameBoy) StartRecording(rec Recording) error {
+	if gb == nil {
+		return nil
+	}
+
+	if gb.mixer == nil {
+		gb.mixer = newMixer()
+	}
+
+	if gb.mixer.rec != nil {
+		return errors.New("gb: already recording")
+	}
+
+	r, err := newRecorder(rec)
+	if err != nil {
+		return err
+	}
+
+	gb.mixer.rec = r
+	return nil
+}
+
+// StopRecording stops the current recording, finalizing the WAV files.
+func (gb *GameBoy) StopRecording() error {
+	if gb == nil || gb.mixer == nil || gb.mixer.rec == nil {
+		return nil
+	}
+
+	r := gb.mixer.rec
+	gb.mixer.rec = nil
+
+	return r.close()
+}
+
+// Recording reports whether audio is being recorded.
+func (gb *GameBoy) Recording() bool {
+	return gb != nil && gb.mixer != nil && gb.mixer.rec != nil
+}
+
+type recorder struct {
+	res   resampler
+	mix   *wavWriter
+	stems [4]*wavWriter
+	in    [6]float64
+	err   error
+}
+
+func newRecorder(rec Recording) (*recorder, error) {
+	rate := rec.Rate
+	if rate <= 0 {
+		rate = DefaultSampleRate
+	}
+
+	r := &recorder{
+		res: newResampler(6, rate),
+	}
+
+	var err error
+	if rec.Mix != nil {
+		if r.mix, err = newWavWriter(rec.Mix, rate, 2); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, w := range []io.WriteSeeker{rec.Pulse1, rec.Pulse2, rec.Wave, rec.Noise} {
+		if w == nil {
+			continue
+		}
+		if r.stems[i], err = newWavWriter(w, rate, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *recorder) push(left, right float64, channels [4]float64) {
+	r.in[0], r.in[1] = left, right
+	copy(r.in[2:], channels[:])
+	if !r.res.push(r.in[:]) || r.err != nil {
+		return
+	}
+
+	if r.mix != nil {
+		r.err = r.mix.write(pcm(r.res.out[0]), pcm(r.res.out[1]))
+	}
+
+	for i, w := range r.stems {
+		if w == nil || r.err != nil {
+			continue
+		}
+		// stems are not attenuated by the mixer, keep them at the same
+		// level a single channel has in the mix
+		r.err = w.write(pcm(r.res.out[2+i] / 4))
+	}
+}
+
+func (r *recorder) close() error {
+	err := r.err
+
+	if r.mix != nil {
+		if cerr := r.mix.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	for _, w := range r.stems {
+		if w == nil {
+			continue
+		}
+		if cerr := w.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// wavWriter writes 16 bit PCM WAV files, the sizes in the header are filled
+// in when closing.
+type wavWriter struct {
+	ws   io.WriteSeeker
+	w    *bufio.Writer
+	size uint32
+	buf  [2]byte
+}
+
+func newWavWriter(ws io.WriteSeeker, rate, channels int) (*wavWriter, error) {
+	w := &wavWriter{
+		ws: ws,
+		w:  bufio.NewWriter(ws),
+	}
+
+	blockAlign := channels * 2
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(0), // riff size, filled in on close
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),                // fmt chunk size
+		uint16(1),                 // pcm
+		uint16(channels),          // channels
+		uint32(rate),              // sample rate
+		uint32(rate * blockAlign), // byte rate
+		uint16(blockAlign),        // block align
+		uint16(16),                // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(0), // data size, filled in on close
+	}
+	for _, v := range header {
+		if err := binary.Write(w.w, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func (w *wavWriter) write(samples ...int16) error {
+	for _, s := range samples {
+		binary.LittleEndian.PutUint16(w.buf[:], uint16(s))
+		if _, err := w.w.Write(w.buf[:]); err != nil {
+			return err
+		}
+		w.size += 2
+	}
+
+	return nil
+}
+
+func (w *wavWriter) close() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	sizes := []struct {
+		offset int64
+		v      uint32
+	}{
+		{4, 36 + w.size},
+		{40, w.size},
+	}
+	for _, s := range sizes {
+		if _, err := w.ws.Seek(s.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w.ws, binary.LittleEndian, s.v); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.ws.Seek(0, io.SeekEnd)
+	return err
+}
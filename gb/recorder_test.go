@@ -0,0 +1,81 @@
+package gb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecording(t *testing.T) {
+	f, err := os.Open(filepath.Join("../testdata", "flappyboy.gb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cart, err := NewCartridge(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gb GameBoy
+	if err := gb.InsertCartridge(cart, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gb.PowerOn()
+
+	mix, err := ioutil.TempFile("", "mix-*.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(mix.Name())
+	defer mix.Close()
+
+	noise, err := ioutil.TempFile("", "noise-*.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(noise.Name())
+	defer noise.Close()
+
+	if err := gb.StartRecording(Recording{Rate: 22050, Mix: mix, Noise: noise}); err != nil {
+		t.Fatal(err)
+	}
+	start := gb.machineCycles
+	for i := 0; i < 60; i++ {
+		gb.ClockFrame()
+	}
+	if err := gb.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	frames := int(float64(gb.machineCycles-start) / machineFreq * 22050)
+
+	tests := []struct {
+		f        *os.File
+		channels int
+	}{
+		{mix, 2},
+		{noise, 1},
+	}
+	for _, tt := range tests {
+		data, err := ioutil.ReadFile(tt.f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := string(data[0:4])+string(data[8:16]), "RIFFWAVEfmt "; got != want {
+			t.Errorf("%s: got header %q, want %q", tt.f.Name(), got, want)
+		}
+		if got, want := int(binary.LittleEndian.Uint16(data[22:])), tt.channels; got != want {
+			t.Errorf("%s: got %d channels, want %d", tt.f.Name(), got, want)
+		}
+		if got, want := int(binary.LittleEndian.Uint32(data[4:])), len(data)-8; got != want {
+			t.Errorf("%s: got riff size %d, want %d", tt.f.Name(), got, want)
+		}
+		if got, want := int(binary.LittleEndian.Uint32(data[40:])), frames*tt.channels*2; got < want-4 || got > want+4 {
+			t.Errorf("%s: got data size %d, want ~%d", tt.f.Name(), got, want)
+		}
+	}
+}
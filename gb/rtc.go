@@ -0,0 +1,246 @@
+package gb
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// rtc registers, selected by writing their number to the ram bank register.
+const (
+	rtcS  = 0x08 // Seconds   0-59 (0-3Bh)
+	rtcM  = 0x09 // Minutes   0-59 (0-3Bh)
+	rtcH  = 0x0A // Hours     0-23 (0-17h)
+	rtcDL = 0x0B // Lower 8 bits of Day Counter (0-FFh)
+	rtcDH = 0x0C // Upper 1 bit of Day Counter, Carry Bit, Halt Flag
+	//              Bit 0  Most significant bit of Day Counter (Bit 8)
+	//              Bit 6  Halt (0=Active, 1=Stop Timer)
+	//              Bit 7  Day Counter Carry Bit (1=Counter Overflow)
+
+	rtcDayHi = 1 << 0
+	rtcHalt  = 1 << 6
+	rtcCarry = 1 << 7
+
+	// the footer appended to the sav: the live and the latched registers as
+	// 32 bit little endian words, followed by a 64 bit unix timestamp. Some
+	// emulators only write 32 bits of timestamp.
+	rtcFooterSize    = 48
+	rtcFooterMinSize = 44
+)
+
+type rtcRegs struct {
+	S, M, H uint8
+	D       uint16 // 9 bits
+	halt    bool
+	carry   bool
+}
+
+func (r *rtcRegs) read(reg uint8) uint8 {
+	switch reg {
+	case rtcS:
+		return r.S
+	case rtcM:
+		return r.M
+	case rtcH:
+		return r.H
+	case rtcDL:
+		return uint8(r.D)
+	case rtcDH:
+		v := uint8(r.D>>8) & rtcDayHi
+		if r.halt {
+			v |= rtcHalt
+		}
+		if r.carry {
+			v |= rtcCarry
+		}
+		return v
+	}
+
+	return 0xFF
+}
+
+func (r *rtcRegs) write(reg uint8, v uint8) {
+	switch reg {
+	case rtcS:
+		r.S = v & 0x3F
+	case rtcM:
+		r.M = v & 0x3F
+	case rtcH:
+		r.H = v & 0x1F
+	case rtcDL:
+		r.D = r.D&0x100 | uint16(v)
+	case rtcDH:
+		r.D = r.D&0xFF | uint16(v&rtcDayHi)<<8
+		r.halt = v&rtcHalt > 0
+		r.carry = v&rtcCarry > 0
+	}
+}
+
+// tick advances the clock by one second. The counters only carry when they
+// go past their last valid value, out of range values count up until they
+// wrap around at the width of the register.
+func (r *rtcRegs) tick() {
+	r.S = (r.S + 1) & 0x3F
+	if r.S != 60 {
+		return
+	}
+	r.S = 0
+
+	r.M = (r.M + 1) & 0x3F
+	if r.M != 60 {
+		return
+	}
+	r.M = 0
+
+	r.H = (r.H + 1) & 0x1F
+	if r.H != 24 {
+		return
+	}
+	r.H = 0
+
+	r.D++
+	if r.D == 512 {
+		r.D = 0
+		r.carry = true
+	}
+}
+
+// advance moves the clock forward by secs seconds at once.
+func (r *rtcRegs) advance(secs uint64) {
+	// out of range values don't carry like the rest, tick them until they
+	// wrap
+	for secs > 0 && (r.S >= 60 || r.M >= 60 || r.H >= 24) {
+		r.tick()
+		secs--
+	}
+
+	total := uint64(r.S) + uint64(r.M)*60 + uint64(r.H)*3600 + uint64(r.D)*86400 + secs
+	r.S = uint8(total % 60)
+	r.M = uint8(total / 60 % 60)
+	r.H = uint8(total / 3600 % 24)
+	days := total / 86400
+	if days >= 512 {
+		r.carry = true
+	}
+	r.D = uint16(days % 512)
+}
+
+// Clock is the source of wall clock time for carts with a real time clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type emulatedTime struct{}
+
+func (emulatedTime) Now() time.Time { return time.Unix(0, 0) }
+
+var (
+	// SystemClock is the clock used by default, it reads the time of the
+	// host.
+	SystemClock Clock = systemClock{}
+
+	// EmulatedTime makes real time clocks only advance with the emulated
+	// machine, they don't catch up with the time spent closed and saves don't
+	// record when they were written. Use it when the clock must be fully
+	// deterministic, like in tests or when playing back input.
+	EmulatedTime Clock = emulatedTime{}
+)
+
+// rtc is the real time clock of mbc3 carts. It ticks with the emulated
+// machine while running, and catches up with the wall clock when loading a
+// save.
+type rtc struct {
+	live      rtcRegs
+	latched   rtcRegs
+	cycles    uint64 // machine cycles into the current second
+	wallClock Clock
+}
+
+// now returns the current unix time, ok is false if only emulated time
+// counts.
+func (r *rtc) now() (now int64, ok bool) {
+	switch c := r.wallClock.(type) {
+	case nil:
+		return SystemClock.Now().Unix(), true
+	case emulatedTime:
+		return 0, false
+	default:
+		return c.Now().Unix(), true
+	}
+}
+
+func (r *rtc) clock() {
+	if r.live.halt {
+		return
+	}
+
+	r.cycles++
+	if r.cycles < machineFreq {
+		return
+	}
+	r.cycles = 0
+	r.live.tick()
+}
+
+func (r *rtc) latch() {
+	r.latched = r.live
+}
+
+// read returns the latched value of reg, the live registers can't be read
+// directly.
+func (r *rtc) read(reg uint8) uint8 {
+	return r.latched.read(reg)
+}
+
+// write sets the live value of reg. The latched value is updated as well so
+// the program can read back what it wrote without latching again.
+func (r *rtc) write(reg uint8, v uint8) {
+	if reg == rtcS {
+		// writing the seconds resets the divider
+		r.cycles = 0
+	}
+
+	r.live.write(reg, v)
+	r.latched.write(reg, v)
+}
+
+func (r *rtc) save() []byte {
+	ret := make([]byte, rtcFooterSize)
+	for i, reg := range []uint8{rtcS, rtcM, rtcH, rtcDL, rtcDH} {
+		binary.LittleEndian.PutUint32(ret[i*4:], uint32(r.live.read(reg)))
+		binary.LittleEndian.PutUint32(ret[20+i*4:], uint32(r.latched.read(reg)))
+	}
+	// emulated time leaves the timestamp out, as 0
+	if now, ok := r.now(); ok {
+		binary.LittleEndian.PutUint64(ret[40:], uint64(now))
+	}
+
+	return ret
+}
+
+func (r *rtc) loadSave(d []byte) {
+	for i, reg := range []uint8{rtcS, rtcM, rtcH, rtcDL, rtcDH} {
+		r.live.write(reg, uint8(binary.LittleEndian.Uint32(d[i*4:])))
+		r.latched.write(reg, uint8(binary.LittleEndian.Uint32(d[20+i*4:])))
+	}
+
+	var saved int64
+	if len(d) >= rtcFooterSize {
+		saved = int64(binary.LittleEndian.Uint64(d[40:]))
+	} else {
+		saved = int64(binary.LittleEndian.Uint32(d[40:]))
+	}
+
+	// catch up with the time the game spent closed, a save without a
+	// timestamp has nothing to catch up with
+	now, ok := r.now()
+	if saved == 0 || !ok || r.live.halt {
+		return
+	}
+	if elapsed := now - saved; elapsed > 0 {
+		r.live.advance(uint64(elapsed))
+	}
+}
@@ -1,17 +1,155 @@
 package gb
 
+const (
+	serialTransferStart = 1 << 7
+	serialInternalClock = 1 << 0
+
+	// the internal clock shifts a bit on every falling edge of bit 8 of DIV,
+	// 8192Hz
+	serialClockBit = 1 << 8
+)
+
+// Link is the other end of the serial port, a cable to another console, a
+// printer, or anything else that speaks the protocol.
+type Link interface {
+	// Transfer is called when a transfer clocked by this GameBoy starts, out
+	// is the byte that will be shifted out and the returned byte is the one
+	// shifted in, a bit at a time over the rest of the transfer. Return 0xFF
+	// if nothing is listening on the other end.
+	Transfer(out uint8) (in uint8)
+}
+
+// bitClocker is implemented by links that shift the other end a bit at a
+// time, clockBit is called on every edge of this GameBoy's serial clock
+// during a transfer, the first one right after Transfer.
+type bitClocker interface {
+	clockBit()
+}
+
+// Connect plugs l into the serial port, a nil Link disconnects it. Transfers
+// complete even when nothing is connected, reading 0xFF, like they do on a
+// real console.
+func (gb *GameBoy) Connect(l Link) {
+	if gb == nil {
+		return
+	}
+
+	gb.link = l
+}
+
+// ExternalTransfer is called by the other end of the link to clock a whole
+// byte into this GameBoy. It only succeeds if a transfer using the external
+// clock is in progress, returning the byte that was shifted out, otherwise
+// the other end reads 0xFF.
+func (gb *GameBoy) ExternalTransfer(in uint8) (out uint8) {
+	if gb == nil {
+		return 0xFF
+	}
+
+	s, ok := gb.serial.(*serial)
+	if !ok {
+		return 0xFF
+	}
+
+	return s.external(gb, in)
+}
+
 type serial struct {
-	SB, SC uint8
+	SB uint8 // 0xFF01 - SB - Serial transfer data (R/W)
+	SC uint8 // 0xFF02 - SC - Serial Transfer Control (R/W)
+
+	bits       uint8 // bits left to shift in the current transfer
+	in         uint8 // the bits the other end has yet to shift in
+	prevDivBit bool
+}
+
+func (s *serial) clock(gb *GameBoy) {
+	divBit := gb.timer.DIV&serialClockBit > 0
+	falling := s.prevDivBit && !divBit
+	s.prevDivBit = divBit
+
+	if !falling || s.bits == 0 || s.SC&serialInternalClock == 0 {
+		return
+	}
+
+	if s.bits == 8 {
+		s.in = 0xFF
+		if gb.link != nil {
+			s.in = gb.link.Transfer(s.SB)
+		}
+	}
+
+	// the msb goes out first, and the other end's msb comes in at the bottom
+	s.SB = s.SB<<1 | s.in>>7
+	s.in <<= 1
+	s.bits--
+	if c, ok := gb.link.(bitClocker); ok {
+		c.clockBit()
+	}
+	if s.bits == 0 {
+		s.complete(gb)
+	}
+}
+
+// listening reports whether a transfer using the external clock is in
+// progress.
+func (s *serial) listening() bool {
+	return s.SC&serialTransferStart > 0 && s.SC&serialInternalClock == 0
+}
+
+// external completes a transfer clocked by the other end of the link.
+func (s *serial) external(gb *GameBoy, in uint8) uint8 {
+	if !s.listening() {
+		return 0xFF
+	}
+
+	out := s.SB
+	s.SB = in
+	s.complete(gb)
+	return out
 }
 
-func (s *serial) clock(gb *GameBoy) {}
+// startExternal gets ready to shift in a byte clocked by the other end of the
+// link a bit at a time, returning the byte that will be shifted out.
+func (s *serial) startExternal(in uint8) uint8 {
+	s.in = in
+	if !s.listening() {
+		return 0xFF
+	}
+
+	return s.SB
+}
+
+// externalBit shifts a bit clocked by the other end of the link.
+func (s *serial) externalBit(gb *GameBoy) {
+	if !s.listening() || s.bits == 0 {
+		return
+	}
+
+	s.SB = s.SB<<1 | s.in>>7
+	s.in <<= 1
+	s.bits--
+	if s.bits == 0 {
+		s.complete(gb)
+	}
+}
+
+func (s *serial) complete(gb *GameBoy) {
+	s.SC &^= serialTransferStart
+	s.bits = 0
+	gb.interruptCtrl.raise(serialInterrupt)
+}
 
 func (s *serial) write(addr uint16, v uint8) {
 	switch addr {
 	case ioRegs.SB:
 		s.SB = v
 	case ioRegs.SC:
-		s.SC = v
+		s.SC = v & (serialTransferStart | serialInternalClock)
+		s.bits = 0
+		if s.SC&serialTransferStart > 0 {
+			s.bits = 8
+		}
 	default:
 		unmappedWrite("serial", addr, v)
 	}
@@ -22,7 +160,7 @@ func (s *serial) read(addr uint16) uint8 {
 	case ioRegs.SB:
 		return s.SB
 	case ioRegs.SC:
-		return s.SC
+		return s.SC | 0x7E
 	default:
 		unmappedRead("serial", addr)
 		return 0
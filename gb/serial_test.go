@@ -0,0 +1,124 @@
+package gb
+
+import "testing"
+
+type echoLink struct {
+	in, out []uint8
+}
+
+func (l *echoLink) Transfer(out uint8) uint8 {
+	l.out = append(l.out, out)
+	in := l.in[0]
+	l.in = l.in[1:]
+	return in
+}
+
+func TestSerialInternalClock(t *testing.T) {
+	tests := []struct {
+		name string
+		link *echoLink
+		want uint8
+	}{
+		{"disconnected", nil, 0xFF},
+		{"connected", &echoLink{in: []uint8{0x5A}}, 0x5A},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gb GameBoy
+			gb.PowerOn()
+			if tt.link != nil {
+				gb.Connect(tt.link)
+			}
+
+			gb.write(ioRegs.SB, 0xA5)
+			gb.write(ioRegs.SC, 0x81)
+
+			// 8 bits at 8192Hz, 128 machine cycles each. The first bit may
+			// take less depending on the phase of DIV.
+			cycles := 0
+			for gb.read(ioRegs.SC)&0x80 > 0 {
+				gb.clockCompensate()
+				cycles++
+				if cycles > 8*128 {
+					t.Fatal("transfer did not complete")
+				}
+			}
+			if cycles <= 7*128 {
+				t.Errorf("transfer took %d machine cycles, want more than %d", cycles, 7*128)
+			}
+
+			if got := gb.read(ioRegs.SB); got != tt.want {
+				t.Errorf("got SB 0x%02X, want 0x%02X", got, tt.want)
+			}
+			if gb.interruptCtrl.IF&serialInterrupt == 0 {
+				t.Error("serial interrupt not raised")
+			}
+			if tt.link != nil && (len(tt.link.out) != 1 || tt.link.out[0] != 0xA5) {
+				t.Errorf("link got %X, want [A5]", tt.link.out)
+			}
+		})
+	}
+}
+
+func TestSerialShift(t *testing.T) {
+	var gb GameBoy
+	gb.PowerOn()
+	gb.Connect(&echoLink{in: []uint8{0x5A}})
+
+	gb.write(ioRegs.SB, 0xA5)
+	gb.write(ioRegs.SC, 0x81)
+
+	var got []uint8
+	prev := gb.read(ioRegs.SB)
+	for gb.read(ioRegs.SC)&0x80 > 0 {
+		gb.clockCompensate()
+		if sb := gb.read(ioRegs.SB); sb != prev {
+			got = append(got, sb)
+			prev = sb
+		}
+	}
+
+	// every bit shifts 0xA5 left, with 0x5A coming in from the right
+	want := []uint8{0x4A, 0x95, 0x2A, 0x55, 0xAB, 0x56, 0xAD, 0x5A}
+	if len(got) != len(want) {
+		t.Fatalf("got SB % X, want % X", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got SB % X, want % X", got, want)
+		}
+	}
+}
+
+func TestSerialExternalClock(t *testing.T) {
+	var gb GameBoy
+	gb.PowerOn()
+
+	if got := gb.ExternalTransfer(0x12); got != 0xFF {
+		t.Errorf("got 0x%02X from an idle port, want 0xFF", got)
+	}
+
+	gb.write(ioRegs.SB, 0x34)
+	gb.write(ioRegs.SC, 0x80)
+
+	// nothing happens until the other end clocks the transfer
+	for i := 0; i < 16*128; i++ {
+		gb.clockCompensate()
+	}
+	if gb.read(ioRegs.SC)&0x80 == 0 {
+		t.Fatal("transfer completed without an external clock")
+	}
+
+	if got := gb.ExternalTransfer(0x12); got != 0x34 {
+		t.Errorf("got 0x%02X, want 0x34", got)
+	}
+	if got := gb.read(ioRegs.SB); got != 0x12 {
+		t.Errorf("got SB 0x%02X, want 0x12", got)
+	}
+	if gb.read(ioRegs.SC)&0x80 > 0 {
+		t.Error("transfer still in progress")
+	}
+	if gb.interruptCtrl.IF&serialInterrupt == 0 {
+		t.Error("serial interrupt not raised")
+	}
+}
@@ -5,71 +5,108 @@ type timerControl uint8
 const (
 	timerEnable      = 1 << 2
 	timerClockSelect = 0x3
+
+	// cycles from TIMA overflowing until it's reloaded, and how long the
+	// reload lasts. TIMA reads 0 in between.
+	timerReloadDelay = 4
+	timerReloadCycle = 4
 )
 
 func (t timerControl) enabled() bool {
 	return t&timerEnable > 0
 }
 
-func (t timerControl) freq() (machineCycles uint16) {
+// bit returns the bit of DIV that clocks TIMA when it falls.
+func (t timerControl) bit() uint16 {
 	switch t & timerClockSelect {
 	case 0:
-		return 1024
+		return 1 << 9 // 4096Hz
 	case 1:
-		return 16
+		return 1 << 3 // 262144Hz
 	case 2:
-		return 64
+		return 1 << 5 // 65536Hz
 	case 3:
-		return 256
+		return 1 << 7 // 16384Hz
 	default:
 		return 0
 	}
 }
 
+// timer increments TIMA on the falling edge of a bit of DIV, ANDed with the
+// enable bit of TAC. Since the edge is detected on the combined signal,
+// resetting DIV or changing TAC can increment TIMA too.
 type timer struct {
-	DIV        uint16
-	TIMA       uint8
-	TMA        uint8
-	TAC        timerControl
-	reloadNext int
-	reload     bool
+	DIV  uint16
+	TIMA uint8
+	TMA  uint8
+	TAC  timerControl
+
+	signal    bool
+	overflow  int // cycles until TIMA is reloaded
+	reloading int // cycles left in the reload, TIMA follows TMA meanwhile
 }
 
 func (t *timer) clock(gb *GameBoy) {
-	t.DIV++
+	if t.reloading > 0 {
+		t.reloading--
+	}
 
-	if t.reloadNext > 0 {
-		t.reloadNext--
-		if t.reloadNext == 0 {
-			t.reload = true //does it fallthrough?
+	if t.overflow > 0 {
+		t.overflow--
+		if t.overflow == 0 {
+			t.TIMA = t.TMA
+			t.reloading = timerReloadCycle
+			gb.interruptCtrl.raise(timerInterrupt)
 		}
 	}
 
-	if t.reload {
-		t.reload = false
-		t.TIMA = t.TMA
-		gb.interruptCtrl.raise(timerInterrupt)
+	t.setDIV(t.DIV + 1)
+}
+
+func (t *timer) setDIV(v uint16) {
+	t.DIV = v
+	t.update()
+}
+
+// update increments TIMA if the signal clocking it fell.
+func (t *timer) update() {
+	signal := t.TAC.enabled() && t.DIV&t.TAC.bit() > 0
+	falling := t.signal && !signal
+	t.signal = signal
+
+	if !falling {
+		return
 	}
 
-	if t.TAC.enabled() && t.DIV%t.TAC.freq() == 0 {
-		prev := t.TIMA
-		t.TIMA++
-		if t.TIMA < prev {
-			t.reloadNext = 4
-		}
+	t.TIMA++
+	if t.TIMA == 0 {
+		t.overflow = timerReloadDelay
 	}
 }
 
 func (t *timer) write(addr uint16, v uint8) {
 	switch addr {
 	case ioRegs.DIV:
-		t.DIV = 0
+		t.setDIV(0)
 	case ioRegs.TIMA:
-		t.TIMA = v
+		switch {
+		case t.reloading > 0:
+			// the reload wins
+		case t.overflow > 0:
+			// cancels the reload and the interrupt
+			t.overflow = 0
+			t.TIMA = v
+		default:
+			t.TIMA = v
+		}
 	case ioRegs.TMA:
 		t.TMA = v
+		if t.reloading > 0 {
+			t.TIMA = v
+		}
 	case ioRegs.TAC:
 		t.TAC = timerControl(v & 0x7)
+		t.update()
 	default:
 		unmappedWrite("timer", addr, v)
 	}
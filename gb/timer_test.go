@@ -1 +1,102 @@
 package gb
+
+import "testing"
+
+func TestTimerDIVWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		div  uint16
+		tac  uint8
+		want uint8
+	}{
+		{"bit set", 1 << 3, timerEnable | 1, 1},
+		{"bit clear", 1 << 2, timerEnable | 1, 0},
+		{"disabled", 1 << 3, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tm timer
+			tm.write(ioRegs.TAC, tt.tac)
+			tm.setDIV(tt.div)
+			tm.write(ioRegs.DIV, 0)
+
+			if tm.TIMA != tt.want {
+				t.Errorf("got TIMA %d, want %d", tm.TIMA, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimerTACWrite(t *testing.T) {
+	var tm timer
+	tm.setDIV(1 << 9)
+	tm.write(ioRegs.TAC, timerEnable)
+	tm.write(ioRegs.TAC, 0)
+
+	if tm.TIMA != 1 {
+		t.Errorf("got TIMA %d after disabling the timer, want 1", tm.TIMA)
+	}
+}
+
+func TestTimerReload(t *testing.T) {
+	overflow := func() (*GameBoy, *timer) {
+		gb := &GameBoy{interruptCtrl: &interruptCtrl{}}
+		tm := &timer{TIMA: 0xFF, TMA: 0x42}
+		tm.write(ioRegs.TAC, timerEnable|1)
+		tm.setDIV(0x0F)
+		tm.clock(gb)
+		return gb, tm
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		gb, tm := overflow()
+		if tm.TIMA != 0 {
+			t.Fatalf("got TIMA 0x%02X right after the overflow, want 0", tm.TIMA)
+		}
+		for i := 0; i < timerReloadDelay; i++ {
+			tm.clock(gb)
+		}
+		if tm.TIMA != 0x42 {
+			t.Errorf("got TIMA 0x%02X, want 0x42", tm.TIMA)
+		}
+		if gb.interruptCtrl.IF&timerInterrupt == 0 {
+			t.Error("timer interrupt not raised")
+		}
+	})
+
+	t.Run("TIMA write cancels", func(t *testing.T) {
+		gb, tm := overflow()
+		tm.write(ioRegs.TIMA, 0x10)
+		for i := 0; i < timerReloadDelay; i++ {
+			tm.clock(gb)
+		}
+		if tm.TIMA != 0x10 {
+			t.Errorf("got TIMA 0x%02X, want 0x10", tm.TIMA)
+		}
+		if gb.interruptCtrl.IF&timerInterrupt != 0 {
+			t.Error("timer interrupt raised")
+		}
+	})
+
+	t.Run("TIMA write ignored while reloading", func(t *testing.T) {
+		gb, tm := overflow()
+		for i := 0; i < timerReloadDelay; i++ {
+			tm.clock(gb)
+		}
+		tm.write(ioRegs.TIMA, 0x10)
+		if tm.TIMA != 0x42 {
+			t.Errorf("got TIMA 0x%02X, want 0x42", tm.TIMA)
+		}
+	})
+
+	t.Run("TMA write while reloading", func(t *testing.T) {
+		gb, tm := overflow()
+		for i := 0; i < timerReloadDelay; i++ {
+			tm.clock(gb)
+		}
+		tm.write(ioRegs.TMA, 0x10)
+		if tm.TIMA != 0x10 {
+			t.Errorf("got TIMA 0x%02X, want 0x10", tm.TIMA)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package gb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	vgmVersion    = 0x161 // first version to support the DMG
+	vgmHeaderSize = 0x100
+	vgmRate       = 44100
+
+	vgmCmdDMGWrite = 0xB3
+	vgmCmdWait     = 0x61
+	vgmCmdWait735  = 0x62 // 1/60s
+	vgmCmdWait882  = 0x63 // 1/50s
+	vgmCmdWaitN    = 0x70 // 0x7n waits n+1 samples
+	vgmCmdEnd      = 0x66
+)
+
+// StartVGMLog logs every write to the sound registers as a VGM file until
+// StopVGMLog is called. The current state of the apu is written first, so
+// that playback starts from where the game is.
+func (gb *GameBoy) StartVGMLog(ws io.WriteSeeker) error {
+	if gb == nil {
+		return nil
+	}
+
+	if gb.vgm != nil {
+		return errors.New("gb: already logging vgm")
+	}
+
+	l, err := newVGMLogger(ws, gb.machineCycles)
+	if err != nil {
+		return err
+	}
+
+	if gb.apu != nil {
+		for _, w := range gb.apu.snapshot() {
+			l.write(gb.machineCycles, w.addr, w.v)
+		}
+	}
+
+	gb.vgm = l
+	return nil
+}
+
+// StopVGMLog stops the current log, finalizing the VGM file.
+func (gb *GameBoy) StopVGMLog() error {
+	if gb == nil || gb.vgm == nil {
+		return nil
+	}
+
+	l := gb.vgm
+	gb.vgm = nil
+
+	return l.close(gb.machineCycles)
+}
+
+// VGMLogging reports whether the sound registers are being logged.
+func (gb *GameBoy) VGMLogging() bool {
+	return gb != nil && gb.vgm != nil
+}
+
+type regWrite struct {
+	addr uint16
+	v    uint8
+}
+
+// snapshot returns the register writes needed to bring a freshly powered apu
+// to the current state. Playing channels are retriggered, so their envelope
+// and length start over.
+func (a *apu) snapshot() []regWrite {
+	ret := []regWrite{
+		{0xFF26, a.OnOff & apuPower},
+	}
+
+	// wave ram can always be written to while the apu is off
+	ret = append(ret, regWrite{0xFF1A, 0})
+	for i, v := range a.wave.Pattern {
+		ret = append(ret, regWrite{0xFF30 + uint16(i), v})
+	}
+
+	if !a.powered() {
+		return ret
+	}
+
+	trigger := func(enabled bool) uint8 {
+		if enabled {
+			return 0x80
+		}
+		return 0
+	}
+
+	return append(ret,
+		regWrite{0xFF24, a.ChannelControl},
+		regWrite{0xFF25, a.OutputTerminal},
+
+		regWrite{0xFF10, a.p1.Sweep},
+		regWrite{0xFF11, a.p1.Length},
+		regWrite{0xFF12, a.p1.VolumeEnvelope},
+		regWrite{0xFF13, a.p1.FreqLo},
+		regWrite{0xFF14, a.p1.FreqHi&0x47 | trigger(a.p1.enabled)},
+
+		regWrite{0xFF16, a.p2.Length},
+		regWrite{0xFF17, a.p2.VolumeEnvelope},
+		regWrite{0xFF18, a.p2.FreqLo},
+		regWrite{0xFF19, a.p2.FreqHi&0x47 | trigger(a.p2.enabled)},
+
+		regWrite{0xFF1A, a.wave.OnOff},
+		regWrite{0xFF1B, a.wave.Length},
+		regWrite{0xFF1C, a.wave.OutputLevel},
+		regWrite{0xFF1D, a.wave.FreqLo},
+		regWrite{0xFF1E, a.wave.FreqHi&0x47 | trigger(a.wave.enabled)},
+
+		regWrite{0xFF20, a.noise.Length},
+		regWrite{0xFF21, a.noise.VolumeEnvelope},
+		regWrite{0xFF22, a.noise.Counter},
+		regWrite{0xFF23, a.noise.CounterLoad&0x40 | trigger(a.noise.enabled)},
+	)
+}
+
+// vgmLogger writes VGM files, waits are derived from the machine cycles
+// elapsed between writes. The header is filled in when closing.
+type vgmLogger struct {
+	ws  io.WriteSeeker
+	w   *bufio.Writer
+	err error
+
+	start   uint64 // machine cycle the log started at
+	samples uint64 // samples waited so far
+	size    uint32 // bytes written after the header
+}
+
+func newVGMLogger(ws io.WriteSeeker, cycles uint64) (*vgmLogger, error) {
+	l := &vgmLogger{
+		ws:    ws,
+		w:     bufio.NewWriter(ws),
+		start: cycles,
+	}
+
+	// reserve the header, it's written on close
+	var header [vgmHeaderSize]byte
+	if _, err := l.w.Write(header[:]); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// write logs a write of v to addr, which must be in the 0xFF10-0xFF3F range.
+func (l *vgmLogger) write(cycles uint64, addr uint16, v uint8) {
+	l.wait(cycles)
+	l.emit(vgmCmdDMGWrite, uint8(addr-0xFF10), v)
+}
+
+// wait catches up with cycles, the remainder that doesn't make a whole
+// sample is carried over to the next wait.
+func (l *vgmLogger) wait(cycles uint64) {
+	if cycles < l.start {
+		return
+	}
+
+	target := (cycles - l.start) * vgmRate / machineFreq
+	for l.samples < target {
+		n := target - l.samples
+		switch {
+		case n == 735:
+			l.emit(vgmCmdWait735)
+		case n == 882:
+			l.emit(vgmCmdWait882)
+		case n <= 16:
+			l.emit(vgmCmdWaitN + uint8(n-1))
+		default:
+			if n > 0xFFFF {
+				n = 0xFFFF
+			}
+			l.emit(vgmCmdWait, uint8(n), uint8(n>>8))
+		}
+		l.samples += n
+	}
+}
+
+func (l *vgmLogger) emit(cmd ...uint8) {
+	if l.err != nil {
+		return
+	}
+
+	_, l.err = l.w.Write(cmd)
+	l.size += uint32(len(cmd))
+}
+
+func (l *vgmLogger) close(cycles uint64) error {
+	l.wait(cycles)
+	l.emit(vgmCmdEnd)
+	if l.err != nil {
+		return l.err
+	}
+
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+
+	var header [vgmHeaderSize]byte
+	copy(header[0x00:], "Vgm ")
+	binary.LittleEndian.PutUint32(header[0x04:], vgmHeaderSize+l.size-0x04) // eof offset
+	binary.LittleEndian.PutUint32(header[0x08:], vgmVersion)
+	binary.LittleEndian.PutUint32(header[0x18:], uint32(l.samples))  // total samples
+	binary.LittleEndian.PutUint32(header[0x34:], vgmHeaderSize-0x34) // data offset
+	binary.LittleEndian.PutUint32(header[0x80:], cpuFreq)            // dmg clock
+
+	if _, err := l.ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := l.ws.Write(header[:]); err != nil {
+		return err
+	}
+
+	_, err := l.ws.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,110 @@
+package gb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVGMLog(t *testing.T) {
+	f, err := os.Open(filepath.Join("../testdata", "flappyboy.gb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cart, err := NewCartridge(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gb GameBoy
+	if err := gb.InsertCartridge(cart, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gb.PowerOn()
+
+	out, err := ioutil.TempFile("", "log-*.vgm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if err := gb.StartVGMLog(out); err != nil {
+		t.Fatal(err)
+	}
+	start := gb.machineCycles
+	for i := 0; i < 60; i++ {
+		gb.ClockFrame()
+	}
+	if err := gb.StopVGMLog(); err != nil {
+		t.Fatal(err)
+	}
+	samples := (gb.machineCycles - start) * vgmRate / machineFreq
+
+	data, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data[0:4]), "Vgm "; got != want {
+		t.Fatalf("got magic %q, want %q", got, want)
+	}
+	if got, want := int(binary.LittleEndian.Uint32(data[0x04:])), len(data)-4; got != want {
+		t.Errorf("got eof offset %d, want %d", got, want)
+	}
+	if got, want := binary.LittleEndian.Uint32(data[0x80:]), uint32(cpuFreq); got != want {
+		t.Errorf("got dmg clock %d, want %d", got, want)
+	}
+	if got, want := uint64(binary.LittleEndian.Uint32(data[0x18:])), samples; got != want {
+		t.Errorf("got %d samples in header, want %d", got, want)
+	}
+
+	// walk the commands, making sure the waits add up and the log ends
+	// properly
+	var waited uint64
+	var writes int
+	pos := 0x34 + int(binary.LittleEndian.Uint32(data[0x34:]))
+loop:
+	for pos < len(data) {
+		cmd := data[pos]
+		switch {
+		case cmd == vgmCmdDMGWrite:
+			if reg := data[pos+1]; reg > 0x2F {
+				t.Fatalf("register %#x out of range at %#x", reg, pos)
+			}
+			writes++
+			pos += 3
+		case cmd == vgmCmdWait:
+			waited += uint64(binary.LittleEndian.Uint16(data[pos+1:]))
+			pos += 3
+		case cmd == vgmCmdWait735:
+			waited += 735
+			pos++
+		case cmd == vgmCmdWait882:
+			waited += 882
+			pos++
+		case cmd&0xF0 == vgmCmdWaitN:
+			waited += uint64(cmd&0x0F) + 1
+			pos++
+		case cmd == vgmCmdEnd:
+			pos++
+			break loop
+		default:
+			t.Fatalf("unexpected command %#x at %#x", cmd, pos)
+		}
+	}
+
+	if pos != len(data) {
+		t.Errorf("log ended at %#x, want %#x", pos, len(data))
+	}
+	if waited != samples {
+		t.Errorf("waited %d samples, want %d", waited, samples)
+	}
+	if writes == 0 {
+		t.Errorf("no register writes were logged")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"image/color"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -20,9 +22,18 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-const targetFrameTime = 1000 / float64(60)
+const (
+	audioSampleRate = 48000
+	audioLatency    = 60 * time.Millisecond
+
+	// maximum deviation from the audio sample rate used to keep the queue
+	// near audioLatency
+	maxRateDelta = 0.005
+)
 
 var (
+	targetFrameTime = time.Duration(math.Round(float64(time.Second) / gb.FrameRate))
+
 	black        = color.RGBA{0x00, 0x00, 0x00, 0xFF}
 	gridColor    = color.RGBA{0xff, 0x00, 0x00, 0x33}
 	dividerColor = color.RGBA{0x1a, 0xcb, 0xe8, 0x99}
@@ -32,10 +43,33 @@ func init() {
 	runtime.LockOSThread()
 }
 
+type options struct {
+	debug        bool
+	stems        bool
+	unrestricted bool // let the cpu access vram and oam at any time
+
+	linkRom string // rom of the second, local, player
+	host    string // address to wait for a networked player on
+	join    string // address of the networked player to connect to
+	printer string // directory printed pages are written to
+}
+
 func main() {
-	debug := flag.Bool("d", false, "print debug info")
+	var opts options
+	flag.BoolVar(&opts.debug, "d", false, "print debug info")
+	flag.BoolVar(&opts.stems, "stems", false, "also record every audio channel to its own file")
+	flag.BoolVar(&opts.unrestricted, "unrestricted", false, "let the cpu access vram and oam while the ppu is using them, for debugging")
+	flag.StringVar(&opts.linkRom, "link", "", "run a second console playing this rom, connected by a link cable, side by side")
+	flag.StringVar(&opts.host, "host", "", "wait for another player to join on this address, eg :5000")
+	flag.StringVar(&opts.join, "join", "", "connect a link cable to the player hosting on this address")
+	flag.StringVar(&opts.printer, "printer", "", "connect a printer that writes pages to this directory")
 	flag.Parse()
 
+	if countSet(opts.linkRom, opts.host, opts.join, opts.printer) > 1 {
+		fmt.Fprintln(os.Stderr, "only one of -link, -host, -join and -printer can be used")
+		os.Exit(2)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, os.Kill)
@@ -44,21 +78,36 @@ func main() {
 		cancel()
 	}()
 
-	if err := run(ctx, flag.Arg(0), *debug); err != nil {
+	if err := run(ctx, flag.Arg(0), opts); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, romPath string, debug bool) error {
+func countSet(s ...string) int {
+	var n int
+	for _, v := range s {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func run(ctx context.Context, romPath string, opts options) error {
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
 		panic(err)
 	}
 	defer sdl.Quit()
 
+	players := 1
+	if opts.linkRom != "" {
+		players = 2
+	}
+
 	mainWindow := &window{
 		Title:         "gb",
-		W:             160,
+		W:             160 * players,
 		H:             144,
 		Scale:         4,
 		WindowFlags:   sdl.WINDOW_SHOWN | sdl.WINDOW_RESIZABLE,
@@ -94,14 +143,104 @@ func run(ctx context.Context, romPath string, debug bool) error {
 	}
 	defer vramWindow.Destroy()
 
+	audioWindow := &window{
+		Title:         "audio",
+		W:             audioViewW,
+		H:             audioViewH,
+		Scale:         3,
+		WindowFlags:   sdl.WINDOW_HIDDEN,
+		RendererFlags: sdl.RENDERER_ACCELERATED | sdl.RENDERER_PRESENTVSYNC,
+		BlendMode:     sdl.BLENDMODE_BLEND,
+		PixelFormat:   sdl.PIXELFORMAT_ABGR8888,
+	}
+	defer audioWindow.Destroy()
+	audioView := &audioView{}
+
 	console := &gb.GameBoy{
-		Debug: debug,
+		Debug:              opts.debug,
+		UnrestrictedAccess: opts.unrestricted,
 	}
 	defer console.Save()
+
+	audioDev, err := openAudio(audioSampleRate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open audio device, running without sound: %v\n", err)
+	} else {
+		defer audioDev.Close()
+		console.SetSampleRate(audioDev.rate)
+	}
+
+	rec := &recorder{stems: opts.stems}
+	defer rec.Stop(console)
+
+	vgm := &vgmLog{}
+	defer vgm.Stop(console)
+
 	if romPath != "" {
-		if err := loadRom(romPath, console); err != nil {
+		if err := loadRom(romPath, savPath(romPath, 1), console); err != nil {
+			return err
+		}
+	}
+
+	// the second player is only around in link mode, it shares the audio
+	// device and the main window but none of the tools
+	var console2 *gb.GameBoy
+	var cable *gb.Cable
+	var splitFrame []uint8
+	if players == 2 {
+		console2 = &gb.GameBoy{UnrestrictedAccess: opts.unrestricted}
+		defer console2.Save()
+		if audioDev != nil {
+			console2.SetSampleRate(audioDev.rate)
+		}
+
+		if err := loadRom(opts.linkRom, savPath(opts.linkRom, 2), console2); err != nil {
+			return err
+		}
+
+		cable = gb.NewCable(console, console2)
+		splitFrame = make([]uint8, 160*144*4*2)
+	}
+
+	var netLink *gb.NetLink
+	if opts.host != "" || opts.join != "" {
+		conn, err := connectLink(ctx, opts.host, opts.join)
+		if err != nil {
+			return err
+		}
+
+		netLink, err = gb.NewNetLink(console, conn)
+		if err != nil {
+			conn.Close()
 			return err
 		}
+		defer netLink.Close()
+	}
+
+	if opts.printer != "" {
+		if err := os.MkdirAll(opts.printer, 0755); err != nil {
+			return err
+		}
+
+		printer := gb.NewPrinter(opts.printer)
+		console.Connect(printer)
+		defer func() {
+			if err := printer.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to write printed page: %v\n", err)
+			}
+		}()
+	}
+
+	clockFrame := console.ClockFrame
+	switch {
+	case cable != nil:
+		clockFrame = func() []uint8 {
+			a, b := cable.ClockFrame()
+			sideBySide(splitFrame, a, b)
+			return splitFrame
+		}
+	case netLink != nil:
+		clockFrame = netLink.ClockFrame
 	}
 
 	running := true
@@ -131,6 +270,8 @@ Loop:
 						nametableWindow.Hide()
 					case vramWindow.ID:
 						vramWindow.Hide()
+					case audioWindow.ID:
+						audioWindow.Hide()
 					}
 				}
 
@@ -138,9 +279,16 @@ Loop:
 				if evt.Type != sdl.DROPFILE {
 					continue
 				}
-				if err := loadRom(evt.File, console); err != nil {
+				if err := rec.Stop(console); err != nil {
+					fmt.Fprintf(os.Stderr, "unable to stop recording: %v\n", err)
+				}
+				if err := vgm.Stop(console); err != nil {
+					fmt.Fprintf(os.Stderr, "unable to stop vgm log: %v\n", err)
+				}
+				if err := loadRom(evt.File, savPath(evt.File, 1), console); err != nil {
 					return err
 				}
+				romPath = evt.File
 
 			case *sdl.KeyboardEvent:
 				switch {
@@ -152,6 +300,8 @@ Loop:
 						nametableWindow.Hide()
 					case vramWindow.ID:
 						vramWindow.Hide()
+					case audioWindow.ID:
+						audioWindow.Hide()
 					}
 
 				case evt.Keysym.Sym == sdl.K_f && evt.State == sdl.PRESSED && evt.Repeat == 0 && evt.WindowID == mainWindow.ID:
@@ -190,6 +340,33 @@ Loop:
 					nametableWindow.Focus()
 				case evt.Keysym.Sym == sdl.K_F2 && evt.State == sdl.PRESSED && evt.Repeat == 0:
 					vramWindow.Focus()
+				case evt.Keysym.Sym == sdl.K_F3 && evt.State == sdl.PRESSED && evt.Repeat == 0:
+					audioWindow.Focus()
+
+				case evt.Keysym.Sym >= sdl.K_1 && evt.Keysym.Sym <= sdl.K_4 && evt.State == sdl.PRESSED && evt.Repeat == 0:
+					ch := gb.Channel(evt.Keysym.Sym - sdl.K_1)
+					if evt.Keysym.Mod&sdl.KMOD_CTRL > 0 {
+						console.SoloChannel(ch, !console.ChannelSoloed(ch))
+					} else {
+						console.MuteChannel(ch, !console.ChannelMuted(ch))
+					}
+
+				case evt.Keysym.Sym == sdl.K_r && evt.State == sdl.PRESSED && evt.Repeat == 0 && evt.Keysym.Mod&sdl.KMOD_CTRL > 0:
+					if err := rec.Toggle(console, romPath); err != nil {
+						fmt.Fprintf(os.Stderr, "unable to record: %v\n", err)
+					}
+
+				case evt.Keysym.Sym == sdl.K_PAGEUP && evt.State == sdl.PRESSED && evt.Repeat == 0:
+					console.PrevTrack()
+					fmt.Printf("track %d\n", console.Track()+1)
+				case evt.Keysym.Sym == sdl.K_PAGEDOWN && evt.State == sdl.PRESSED && evt.Repeat == 0:
+					console.NextTrack()
+					fmt.Printf("track %d\n", console.Track()+1)
+
+				case evt.Keysym.Sym == sdl.K_l && evt.State == sdl.PRESSED && evt.Repeat == 0 && evt.Keysym.Mod&sdl.KMOD_CTRL > 0:
+					if err := vgm.Toggle(console, romPath); err != nil {
+						fmt.Fprintf(os.Stderr, "unable to log vgm: %v\n", err)
+					}
 
 				case evt.Keysym.Sym == sdl.K_s && evt.State == sdl.PRESSED && evt.Repeat == 0 && evt.Keysym.Mod&sdl.KMOD_ALT > 0:
 					console.ToggleSprites()
@@ -217,17 +394,51 @@ Loop:
 					console.Press(gb.Left, evt.State == sdl.PRESSED)
 				case evt.Keysym.Sym == sdl.K_RIGHT:
 					console.Press(gb.Right, evt.State == sdl.PRESSED)
+
+				case evt.Keysym.Sym == sdl.K_o:
+					console2.Press(gb.A, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_u:
+					console2.Press(gb.B, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_p:
+					console2.Press(gb.Start, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_y:
+					console2.Press(gb.Select, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_i:
+					console2.Press(gb.Up, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_k:
+					console2.Press(gb.Down, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_j:
+					console2.Press(gb.Left, evt.State == sdl.PRESSED)
+				case evt.Keysym.Sym == sdl.K_l:
+					console2.Press(gb.Right, evt.State == sdl.PRESSED)
 				}
 			}
 		}
 
+		if netLink != nil && netLink.Err() != nil {
+			fmt.Fprintf(os.Stderr, "link disconnected: %v\n", netLink.Err())
+			netLink.Close()
+			netLink = nil
+			clockFrame = console.ClockFrame
+		}
+
 		if turbo {
 			for i := 0; i < 9; i++ {
-				console.ClockFrame()
+				clockFrame()
+			}
+		}
+
+		frame := clockFrame()
+		samples := console.AudioSamples()
+		if console2 != nil {
+			samples = mixSamples(samples, console2.AudioSamples())
+		}
+		if audioDev != nil && !turbo {
+			if err := audioDev.Queue(samples); err != nil {
+				return err
 			}
 		}
 
-		frame := console.ClockFrame()
 		mainWindow.Clear(black)
 		mainWindow.Update(frame)
 		mainWindow.DrawGrid(gridColor)
@@ -245,26 +456,59 @@ Loop:
 		vramWindow.DrawGrid(gridColor)
 		vramWindow.DrawDivider(dividerColor, 3, false)
 
-		frameTime := float64(time.Since(frameStart).Milliseconds())
-		if frameTime < targetFrameTime {
-			time.Sleep(time.Duration(targetFrameTime-frameTime) * time.Millisecond)
+		audioWindow.Clear(black)
+		if audioWindow.WindowFlags&sdl.WINDOW_SHOWN > 0 {
+			audioView.Draw(audioWindow, console)
+		}
+
+		if audioDev != nil && !turbo {
+			// the audio device drives the pacing, wait until the queue drains
+			// to the target latency and nudge the sample rate so that it
+			// neither starves nor grows
+			queued := audioDev.Queued()
+			for queued > audioLatency {
+				time.Sleep(time.Millisecond)
+				queued = audioDev.Queued()
+			}
+
+			fill := float64(audioLatency-queued) / float64(audioLatency)
+			rate := int(float64(audioDev.rate) * (1 + maxRateDelta*fill))
+			console.SetSampleRate(rate)
+			console2.SetSampleRate(rate)
+		} else if frameTime := time.Since(frameStart); frameTime < targetFrameTime {
+			time.Sleep(targetFrameTime - frameTime)
 		}
 
 		mainWindow.Present()
 		nametableWindow.Present()
 		vramWindow.Present()
+		audioWindow.Present()
 	}
 
 	return nil
 }
 
-func loadRom(path string, console *gb.GameBoy) error {
+// savPath returns where the save of rom is kept, every player gets their own.
+func savPath(rom string, player int) string {
+	base := strings.TrimSuffix(rom, filepath.Ext(rom))
+	if player > 1 {
+		return fmt.Sprintf("%s-%d.sav", base, player)
+	}
+
+	return base + ".sav"
+}
+
+func loadRom(path, savPath string, console *gb.GameBoy) error {
 	rom, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("could not load rom: %w", err)
 	}
 	defer rom.Close()
 
+	if strings.EqualFold(filepath.Ext(path), ".gbs") {
+		return loadGBS(rom, console)
+	}
+
 	cart, err := gb.NewCartridge(rom)
 	if err != nil {
 		return fmt.Errorf("could not load rom: %w", err)
@@ -278,7 +522,7 @@ func loadRom(path string, console *gb.GameBoy) error {
 		return nil
 	}
 
-	savr, savw, err := openSavFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".sav")
+	savr, savw, err := openSavFile(savPath)
 	if err != nil {
 		return fmt.Errorf("could not load sav: %w", err)
 	}
@@ -293,6 +537,23 @@ func loadRom(path string, console *gb.GameBoy) error {
 	return nil
 }
 
+func loadGBS(r io.Reader, console *gb.GameBoy) error {
+	cart, err := gb.NewGBSCartridge(r)
+	if err != nil {
+		return fmt.Errorf("could not load gbs: %w", err)
+	}
+
+	if err := console.InsertCartridge(cart, nil, nil); err != nil {
+		return err
+	}
+
+	info, _ := console.GBSInfo()
+	fmt.Printf("Title: %q\nAuthor: %q\nCopyright: %q\nSongs: %d\n", info.Title, info.Author, info.Copyright, info.Songs)
+	console.PowerOn()
+
+	return nil
+}
+
 func openSavFile(path string) (r io.Reader, w io.WriteCloser, err error) {
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
@@ -313,6 +574,234 @@ func openSavFile(path string) (r io.Reader, w io.WriteCloser, err error) {
 	return bytes.NewReader(data), f, nil
 }
 
+// connectLink waits for a player to join on host, or joins the player hosting
+// on join.
+func connectLink(ctx context.Context, host, join string) (net.Conn, error) {
+	if join != "" {
+		fmt.Printf("joining %s\n", join)
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", join)
+	}
+
+	ln, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	// unblock Accept if we're interrupted while waiting
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ln.Close()
+		case <-stop:
+		}
+	}()
+
+	fmt.Printf("waiting for a player to join on %s\n", ln.Addr())
+	return ln.Accept()
+}
+
+// sideBySide draws the frames of both players into dst, which is twice as
+// wide.
+func sideBySide(dst, a, b []uint8) {
+	const stride = 160 * 4
+	for y := 0; y < 144; y++ {
+		copy(dst[y*stride*2:], a[y*stride:(y+1)*stride])
+		copy(dst[y*stride*2+stride:], b[y*stride:(y+1)*stride])
+	}
+}
+
+// mixSamples adds b into a, clamping, and returns a. Both consoles run at the
+// same rate, any extra samples in b are dropped.
+func mixSamples(a, b []int16) []int16 {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		v := int32(a[i]) + int32(b[i])
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		}
+		if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		a[i] = int16(v)
+	}
+
+	return a
+}
+
+// recorder records the audio of the running game to WAV files named after
+// the rom.
+type recorder struct {
+	stems bool
+	files []*os.File
+}
+
+func (r *recorder) Toggle(console *gb.GameBoy, romPath string) error {
+	if console.Recording() {
+		return r.Stop(console)
+	}
+
+	if romPath == "" {
+		return nil
+	}
+
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(romPath, filepath.Ext(romPath)), time.Now().Format("20060102-150405"))
+
+	type output struct {
+		dst    *io.WriteSeeker
+		suffix string
+	}
+
+	var rec gb.Recording
+	outputs := []output{{&rec.Mix, ""}}
+	if r.stems {
+		outputs = append(outputs,
+			output{&rec.Pulse1, "-p1"},
+			output{&rec.Pulse2, "-p2"},
+			output{&rec.Wave, "-wave"},
+			output{&rec.Noise, "-noise"},
+		)
+	}
+
+	for _, out := range outputs {
+		f, err := os.Create(base + out.suffix + ".wav")
+		if err != nil {
+			r.closeFiles()
+			return err
+		}
+		r.files = append(r.files, f)
+		*out.dst = f
+	}
+
+	if err := console.StartRecording(rec); err != nil {
+		r.closeFiles()
+		return err
+	}
+
+	fmt.Printf("recording to %s.wav\n", base)
+	return nil
+}
+
+func (r *recorder) Stop(console *gb.GameBoy) error {
+	if !console.Recording() {
+		return nil
+	}
+
+	err := console.StopRecording()
+	if cerr := r.closeFiles(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (r *recorder) closeFiles() error {
+	var err error
+	for _, f := range r.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	r.files = nil
+
+	return err
+}
+
+// vgmLog logs the sound register writes of the running game to a VGM file
+// named after the rom.
+type vgmLog struct {
+	f *os.File
+}
+
+func (l *vgmLog) Toggle(console *gb.GameBoy, romPath string) error {
+	if console.VGMLogging() {
+		return l.Stop(console)
+	}
+
+	if romPath == "" {
+		return nil
+	}
+
+	path := fmt.Sprintf("%s-%s.vgm", strings.TrimSuffix(romPath, filepath.Ext(romPath)), time.Now().Format("20060102-150405"))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := console.StartVGMLog(f); err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+
+	fmt.Printf("logging vgm to %s\n", path)
+	return nil
+}
+
+func (l *vgmLog) Stop(console *gb.GameBoy) error {
+	if !console.VGMLogging() {
+		return nil
+	}
+
+	err := console.StopVGMLog()
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+
+	return err
+}
+
+type audio struct {
+	dev  sdl.AudioDeviceID
+	rate int
+	buf  []byte
+}
+
+func openAudio(rate int) (*audio, error) {
+	desired := sdl.AudioSpec{
+		Freq:     int32(rate),
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 2,
+		Samples:  1024,
+	}
+	var obtained sdl.AudioSpec
+
+	dev, err := sdl.OpenAudioDevice("", false, &desired, &obtained, sdl.AUDIO_ALLOW_FREQUENCY_CHANGE)
+	if err != nil {
+		return nil, err
+	}
+
+	sdl.PauseAudioDevice(dev, false)
+
+	return &audio{
+		dev:  dev,
+		rate: int(obtained.Freq),
+	}, nil
+}
+
+// Queue queues interleaved stereo samples for playback.
+func (a *audio) Queue(samples []int16) error {
+	a.buf = a.buf[:0]
+	for _, s := range samples {
+		a.buf = append(a.buf, byte(s), byte(s>>8))
+	}
+
+	return sdl.QueueAudio(a.dev, a.buf)
+}
+
+// Queued returns how much audio is waiting to be played.
+func (a *audio) Queued() time.Duration {
+	frames := sdl.GetQueuedAudioSize(a.dev) / 4 // 2 channels, 2 bytes each
+	return time.Duration(frames) * time.Second / time.Duration(a.rate)
+}
+
+func (a *audio) Close() {
+	sdl.CloseAudioDevice(a.dev)
+}
+
 type window struct {
 	Title                      string
 	W, H                       int